@@ -40,6 +40,12 @@ func DumpWhitelist() (wl []string) {
 	return
 }
 
+// Whitelisted checks whether the given host:port is whitelisted (either
+// permanently or temporarily), meaning that it will always be detoured.
+func Whitelisted(addr string) bool {
+	return whitelisted(addr)
+}
+
 func whitelisted(addr string) (in bool) {
 	muWhitelist.RLock()
 	defer muWhitelist.RUnlock()
@@ -9,6 +9,7 @@ import (
 
 	"github.com/getlantern/flashlight/config"
 	"github.com/getlantern/flashlight/pubsub"
+	"github.com/getlantern/flashlight/statreporter"
 	"github.com/getlantern/flashlight/util"
 
 	"github.com/getlantern/golog"
@@ -23,8 +24,10 @@ var (
 	log = golog.LoggerFor("flashlight.analytics")
 )
 
+// Configure starts tracking the session with Google Analytics, but only if the
+// user chose to report in detail since GA sees our instance id and IP.
 func Configure(cfg *config.Config, version string) {
-	if cfg.AutoReport != nil && *cfg.AutoReport {
+	if cfg.Stats != nil && cfg.Stats.Tier == statreporter.TierDetailed {
 		pubsub.Sub(pubsub.IP, func(ip string) {
 			log.Debugf("Got IP %v -- starting analytics", ip)
 			go trackSession(ip, version, cfg.Addr, cfg.InstanceId)
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/getlantern/launcher"
+	"github.com/getlantern/pac"
+
+	"github.com/getlantern/flashlight/cleanup"
+	"github.com/getlantern/flashlight/config"
+)
+
+const (
+	// launchItemId identifies our one and only launch item in the journal
+	launchItemId = "lantern"
+)
+
+// initCleanup loads the journal of changes we've made to the system and
+// registers how to undo each kind of change that we make.
+func initCleanup() error {
+	journal, err := config.InConfigDir("cleanup.json")
+	if err != nil {
+		return fmt.Errorf("Unable to determine cleanup journal path: %v", err)
+	}
+	if err := cleanup.Init(journal); err != nil {
+		return err
+	}
+	cleanup.RegisterUndoer(cleanup.SystemProxy, func(entry *cleanup.Entry) error {
+		if err := setUpPacTool(); err != nil {
+			return err
+		}
+		return pac.Off(entry.Id)
+	})
+	// Launch items are persistent, so we only undo them when uninstalling
+	cleanup.RegisterUndoer(cleanup.LaunchItem, func(entry *cleanup.Entry) error {
+		return launcher.RemoveLaunchFile()
+	})
+	return nil
+}
+
+// recordLaunchItem keeps the journal in sync with whether or not we launch on
+// system startup.
+func recordLaunchItem(cfg *config.Config) {
+	if cfg.AutoLaunch != nil && *cfg.AutoLaunch {
+		cleanup.Record(cleanup.LaunchItem, launchItemId, true)
+	} else {
+		cleanup.Done(cleanup.LaunchItem, launchItemId)
+	}
+}
+
+// cleanupAfterChild is called by the panicwrap parent process when Lantern
+// didn't exit cleanly, to undo whatever changes it left behind, like still
+// being the system proxy when there's no longer a proxy to talk to.
+func cleanupAfterChild() {
+	parseFlags()
+	if err := initCleanup(); err != nil {
+		log.Errorf("Unable to initialize cleanup: %v", err)
+		return
+	}
+	if err := cleanup.Restore(false); err != nil {
+		log.Errorf("Unable to clean up after Lantern: %v", err)
+	}
+}
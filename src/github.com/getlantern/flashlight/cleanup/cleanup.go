@@ -0,0 +1,206 @@
+// Package cleanup keeps a journal of the changes that Lantern makes to the
+// system, like setting itself as the system proxy, so that they can be undone
+// even if Lantern is killed before it gets a chance to undo them itself.
+package cleanup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/golog"
+)
+
+// Kinds of system changes that we know about.
+const (
+	SystemProxy = "systemproxy"
+	LaunchItem  = "launchitem"
+)
+
+var (
+	log = golog.LoggerFor("flashlight.cleanup")
+
+	path    string
+	entries []*Entry
+	undoers = make(map[string]Undoer)
+	mutex   sync.Mutex
+)
+
+// Entry is a single change to the system recorded in the journal.
+type Entry struct {
+	// Kind is the kind of change, for example SystemProxy
+	Kind string
+
+	// Id identifies the change among others of the same kind and tells the
+	// Undoer what exactly to undo, for example the URL of the PAC file
+	Id string
+
+	// Time is when the change was made
+	Time time.Time
+
+	// Persistent changes, like launch items, are meant to outlive Lantern and
+	// are only undone by an explicit cleanup, for example when uninstalling
+	Persistent bool
+}
+
+// Undoer undoes the change recorded in the given entry.
+type Undoer func(entry *Entry) error
+
+// Init loads the journal at the given path, which may contain changes left
+// behind by a previous run that didn't exit cleanly.
+func Init(journalPath string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	path = journalPath
+	entries = nil
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("Unable to read cleanup journal: %s", err)
+	}
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		return fmt.Errorf("Unable to parse cleanup journal: %s", err)
+	}
+	return nil
+}
+
+// RegisterUndoer registers the Undoer for the given kind of change.
+func RegisterUndoer(kind string, undoer Undoer) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	undoers[kind] = undoer
+}
+
+// Record records that we've made a change to the system. Recording a change
+// that's already in the journal does nothing.
+func Record(kind string, id string, persistent bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, entry := range entries {
+		if entry.Kind == kind && entry.Id == id && entry.Persistent == persistent {
+			return
+		}
+	}
+	entries = append(without(kind, id), &Entry{
+		Kind:       kind,
+		Id:         id,
+		Time:       time.Now(),
+		Persistent: persistent,
+	})
+	save()
+}
+
+// Done records that we've undone a change ourselves and that it no longer
+// needs cleaning up.
+func Done(kind string, id string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	remaining := without(kind, id)
+	if len(remaining) == len(entries) {
+		return
+	}
+	entries = remaining
+	save()
+}
+
+// Pending returns the changes that haven't been undone yet.
+func Pending() []*Entry {
+	mutex.Lock()
+	defer mutex.Unlock()
+	result := make([]*Entry, len(entries))
+	copy(result, entries)
+	return result
+}
+
+// Restore undoes all recorded changes, most recent first, and removes them
+// from the journal. Persistent changes are only undone if includePersistent is
+// true. Changes that couldn't be undone stay in the journal so that we can try
+// again later.
+func Restore(includePersistent bool) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var remaining []*Entry
+	var failures []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Persistent && !includePersistent {
+			remaining = append([]*Entry{entry}, remaining...)
+			continue
+		}
+		undo := undoers[entry.Kind]
+		if undo == nil {
+			log.Debugf("Don't know how to undo %s %s, leaving it in journal", entry.Kind, entry.Id)
+			remaining = append([]*Entry{entry}, remaining...)
+			continue
+		}
+		log.Debugf("Undoing %s %s made at %v", entry.Kind, entry.Id, entry.Time)
+		if err := undo(entry); err != nil {
+			failures = append(failures, fmt.Sprintf("%s %s: %s", entry.Kind, entry.Id, err))
+			remaining = append([]*Entry{entry}, remaining...)
+		}
+	}
+	entries = remaining
+	save()
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Unable to undo %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// without returns the entries except for the one with the given kind and id.
+func without(kind string, id string) []*Entry {
+	result := make([]*Entry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Kind != kind || entry.Id != id {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// save writes the journal to a temp file first and then moves it into place so
+// that being killed halfway through writing can't corrupt it.
+func save() {
+	if path == "" {
+		log.Debugf("Cleanup journal not initialized, not saving")
+		return
+	}
+	bytes, err := json.Marshal(entries)
+	if err != nil {
+		log.Errorf("Unable to marshal cleanup journal: %s", err)
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		log.Errorf("Unable to create temp file for cleanup journal: %s", err)
+		return
+	}
+	_, err = tmp.Write(bytes)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		log.Errorf("Unable to save cleanup journal: %s", err)
+		if err := os.Remove(tmp.Name()); err != nil && !os.IsNotExist(err) {
+			log.Debugf("Unable to remove temp file: %s", err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package cleanup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getlantern/testify/assert"
+)
+
+func TestRestore(t *testing.T) {
+	// A kind of change recorded by a newer version that we don't know about
+	unknown := "tundevice"
+
+	dir, err := ioutil.TempDir("", "cleanup")
+	if !assert.NoError(t, err, "Unable to create temp dir") {
+		return
+	}
+	defer os.RemoveAll(dir)
+	journal := filepath.Join(dir, "cleanup.json")
+
+	if !assert.NoError(t, Init(journal), "Missing journal should be fine") {
+		return
+	}
+	Record(SystemProxy, "http://127.0.0.1:16823/proxy_on.pac", false)
+	Record(SystemProxy, "http://127.0.0.1:16824/proxy_on.pac", false)
+	Record(LaunchItem, "lantern", true)
+	Record(unknown, "tun0", false)
+	Done(SystemProxy, "http://127.0.0.1:16824/proxy_on.pac")
+
+	// Simulate a crash by reloading the journal from disk
+	if !assert.NoError(t, Init(journal), "Unable to reload journal") {
+		return
+	}
+	assert.Len(t, Pending(), 3, "Journal should have survived reload")
+
+	var undone []string
+	undo := func(entry *Entry) error {
+		undone = append(undone, entry.Kind)
+		return nil
+	}
+	RegisterUndoer(SystemProxy, undo)
+	RegisterUndoer(LaunchItem, undo)
+
+	assert.NoError(t, Restore(false))
+	assert.Equal(t, []string{SystemProxy}, undone, "Should only have undone non-persistent changes we know about")
+	assert.Len(t, Pending(), 2, "Persistent and unknown changes should remain")
+
+	RegisterUndoer(unknown, func(entry *Entry) error {
+		return fmt.Errorf("Device busy")
+	})
+	undone = nil
+	assert.Error(t, Restore(true), "Failure to undo should be reported")
+	assert.Equal(t, []string{LaunchItem}, undone, "Should have undone persistent changes")
+	pending := Pending()
+	if assert.Len(t, pending, 1, "Failed change should remain") {
+		assert.Equal(t, unknown, pending[0].Kind)
+	}
+
+	if assert.NoError(t, Init(journal)) {
+		assert.Len(t, Pending(), 1, "Restored changes should have been removed from disk")
+	}
+}
@@ -22,6 +22,7 @@ func (client *Client) getBalancer() *balancer.Balancer {
 // available among the fronted servers.
 func (client *Client) initBalancer(cfg *ClientConfig) (*balancer.Balancer, fronted.Dialer) {
 	var highestQOSFrontedDialer fronted.Dialer
+	ch := newChaos(client.Chaos)
 
 	// The dialers slice must be large enough to handle all fronted and chained
 	// servers.
@@ -33,7 +34,7 @@ func (client *Client) initBalancer(cfg *ClientConfig) (*balancer.Balancer, front
 	for _, s := range cfg.FrontedServers {
 		// Get a dialer for domain fronting (fd) and a dialer to dial to arbitrary
 		// addreses (dialer).
-		fd, dialer := s.dialer(cfg.MasqueradeSets)
+		fd, dialer := s.dialer(cfg.MasqueradeSets, ch)
 		dialers = append(dialers, dialer)
 		if dialer.QOS > highestQOS {
 			// If this dialer as a higher QOS than our current highestQOS, set it as
@@ -54,7 +55,26 @@ func (client *Client) initBalancer(cfg *ClientConfig) (*balancer.Balancer, front
 		}
 	}
 
+	// LAN peers the user has agreed to proxy through go into their own
+	// balancer, which we only use when our own servers fail. We don't use
+	// peers while sharing with them, which keeps two instances from relaying
+	// for each other in a loop.
+	var peerDialers []*balancer.Dialer
+	if !cfg.ShareWithLANPeers {
+		log.Debugf("Adding %d LAN peers", len(cfg.LANPeers))
+		for _, addr := range cfg.LANPeers {
+			peerDialers = append(peerDialers, lanPeerDialer(addr))
+		}
+	}
+
+	for _, d := range append(dialers, peerDialers...) {
+		ch.injectingFaults(d)
+		client.recordingRoutes(d)
+		trackingTraffic(d)
+	}
+
 	bal := balancer.New(dialers...)
+	client.setLANPeers(peerDialers)
 
 	if client.balInitialized {
 		log.Trace("Draining balancer channel")
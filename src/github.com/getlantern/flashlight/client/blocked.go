@@ -0,0 +1,28 @@
+package client
+
+import (
+	"net"
+	"strings"
+)
+
+// setBlockedSites remembers the sites that the user chose to block.
+func (client *Client) setBlockedSites(sites []string) {
+	blocked := make(map[string]bool, len(sites))
+	for _, site := range sites {
+		blocked[strings.ToLower(site)] = true
+	}
+	client.blockedMutex.Lock()
+	client.blocked = blocked
+	client.blockedMutex.Unlock()
+}
+
+// isBlocked checks whether the user chose to block the given host, which may
+// include a port.
+func (client *Client) isBlocked(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	client.blockedMutex.RLock()
+	defer client.blockedMutex.RUnlock()
+	return client.blocked[strings.ToLower(host)]
+}
@@ -0,0 +1,22 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getlantern/testify/assert"
+)
+
+func TestBlockedSites(t *testing.T) {
+	client := &Client{}
+	client.setBlockedSites([]string{"Blocked.com"})
+	assert.True(t, client.isBlocked("blocked.com"))
+	assert.True(t, client.isBlocked("blocked.com:443"))
+	assert.False(t, client.isBlocked("www.blocked.com"))
+
+	req, _ := http.NewRequest("CONNECT", "http://blocked.com:443", nil)
+	resp := httptest.NewRecorder()
+	client.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusForbidden, resp.Code, "Requests to blocked sites should be refused")
+}
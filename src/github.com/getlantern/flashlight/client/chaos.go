@@ -0,0 +1,127 @@
+package client
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/getlantern/balancer"
+	"github.com/getlantern/fronted"
+	"github.com/getlantern/yaml"
+)
+
+// ChaosConfig configures fault injection, which lets developers and QA
+// exercise failover, backoff and status transitions on demand instead of
+// waiting for real network outages. It's only ever set from the command line
+// for the current run and never saved, so that testing can't leave an install
+// degraded.
+type ChaosConfig struct {
+	// DropDialsPercent: percentage of upstream dials to fail
+	DropDialsPercent int
+
+	// DialLatencyMillis: latency to add to every upstream dial
+	DialLatencyMillis int
+
+	// FailMasqueradesPercent: percentage of dials via masquerades to fail,
+	// including those made while verifying masquerades
+	FailMasqueradesPercent int
+
+	// Seed: seeds the choice of which dials fail, so that runs with the same
+	// seed fail the same dials. Each dialer gets its own source of randomness
+	// derived from the seed and its label, so the sequence of failures for a
+	// dialer doesn't depend on how dials are scheduled across dialers. If 0, a
+	// random seed is used.
+	Seed int64
+}
+
+// ParseChaos parses a YAML string like the chaos section of the client config.
+func ParseChaos(chaos string) (*ChaosConfig, error) {
+	cfg := &ChaosConfig{}
+	if err := yaml.Unmarshal([]byte(chaos), cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// chaos injects the faults configured by a ChaosConfig. A nil *chaos injects
+// nothing.
+type chaos struct {
+	*ChaosConfig
+	seed int64
+}
+
+// roller decides which dials of a single dialer fail.
+type roller struct {
+	rnd   *rand.Rand
+	mutex sync.Mutex
+}
+
+func newChaos(cfg *ChaosConfig) *chaos {
+	if cfg == nil || *cfg == (ChaosConfig{}) {
+		return nil
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Debugf("Injecting faults: dropping %d%% of dials, adding %dms latency, failing %d%% of masquerades, seed %d",
+		cfg.DropDialsPercent, cfg.DialLatencyMillis, cfg.FailMasqueradesPercent, seed)
+	return &chaos{
+		ChaosConfig: cfg,
+		seed:        seed,
+	}
+}
+
+// rollerFor creates a roller for the dialer with the given label, seeded from
+// our seed and the label.
+func (c *chaos) rollerFor(label string) *roller {
+	h := fnv.New64a()
+	h.Write([]byte(label))
+	return &roller{rnd: rand.New(rand.NewSource(c.seed ^ int64(h.Sum64())))}
+}
+
+// roll decides whether something that should fail the given percentage of
+// the time fails this time.
+func (r *roller) roll(percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.rnd.Intn(100) < percent
+}
+
+// injectingFaults wraps the given dialer so that its dials are delayed and
+// dropped as configured.
+func (c *chaos) injectingFaults(d *balancer.Dialer) *balancer.Dialer {
+	if c == nil {
+		return d
+	}
+	dial := d.Dial
+	r := c.rollerFor(d.Label)
+	d.Dial = func(network, addr string) (net.Conn, error) {
+		if c.DialLatencyMillis > 0 {
+			time.Sleep(time.Duration(c.DialLatencyMillis) * time.Millisecond)
+		}
+		if r.roll(c.DropDialsPercent) {
+			return nil, fmt.Errorf("Unable to dial %s via %s: failure injected", addr, d.Label)
+		}
+		return dial(network, addr)
+	}
+	return d
+}
+
+// failMasqueradeFunc returns a function that tells the fronted dialer with the
+// given label which masquerades to fail, or nil if we're not failing any.
+func (c *chaos) failMasqueradeFunc(label string) func(*fronted.Masquerade) bool {
+	if c == nil || c.FailMasqueradesPercent <= 0 {
+		return nil
+	}
+	r := c.rollerFor(label)
+	return func(masquerade *fronted.Masquerade) bool {
+		return r.roll(c.FailMasqueradesPercent)
+	}
+}
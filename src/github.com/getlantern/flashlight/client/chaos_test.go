@@ -0,0 +1,55 @@
+package client
+
+import (
+	"net"
+	"testing"
+
+	"github.com/getlantern/balancer"
+	"github.com/getlantern/testify/assert"
+)
+
+func TestChaos(t *testing.T) {
+	assert.Nil(t, newChaos(nil), "No config should mean no chaos")
+	assert.Nil(t, newChaos(&ChaosConfig{}), "Empty config should mean no chaos")
+
+	cfg, err := ParseChaos("{dropdialspercent: 50, seed: 1}")
+	if !assert.NoError(t, err, "Unable to parse chaos") {
+		return
+	}
+	assert.Equal(t, &ChaosConfig{DropDialsPercent: 50, Seed: 1}, cfg)
+	assert.Nil(t, newChaos(cfg).failMasqueradeFunc("test"), "Shouldn't fail masquerades unless configured")
+
+	newDialer := func(ch *chaos, label string) *balancer.Dialer {
+		return ch.injectingFaults(&balancer.Dialer{
+			Label: label,
+			Dial: func(network, addr string) (net.Conn, error) {
+				return nil, nil
+			},
+		})
+	}
+	dialFailures := func(interleaved bool) []bool {
+		ch := newChaos(cfg)
+		d := newDialer(ch, "test")
+		other := newDialer(ch, "other")
+		var failures []bool
+		for i := 0; i < 100; i++ {
+			if interleaved {
+				other.Dial("tcp", "www.example.com:443")
+			}
+			_, err := d.Dial("tcp", "www.example.com:443")
+			failures = append(failures, err != nil)
+		}
+		return failures
+	}
+
+	first := dialFailures(false)
+	dropped := 0
+	for _, failed := range first {
+		if failed {
+			dropped++
+		}
+	}
+	assert.True(t, dropped > 25 && dropped < 75, "Should have dropped about half of dials, dropped %d", dropped)
+	assert.Equal(t, first, dialFailures(false), "Same seed should drop same dials")
+	assert.Equal(t, first, dialFailures(true), "Dials via other dialers shouldn't change which dials get dropped")
+}
@@ -39,6 +39,9 @@ type Client struct {
 	// MinQOS: (optional) the minimum QOS to require from proxies.
 	MinQOS int
 
+	// Chaos: (optional) faults to inject for testing, only for this run
+	Chaos *ChaosConfig
+
 	priorCfg        *ClientConfig
 	priorTrustedCAs *x509.CertPool
 	cfgMutex        sync.RWMutex
@@ -51,6 +54,22 @@ type Client struct {
 	rpCh          chan *httputil.ReverseProxy
 	rpInitialized bool
 
+	// LAN relay, only running while sharing with local peers.
+	relay *lanRelay
+
+	// Balanced dialers for approved LAN peers, only used when our own servers
+	// fail.
+	lanPeers      *balancer.Balancer
+	lanPeersMutex sync.RWMutex
+
+	// Sites the user chose to block.
+	blocked      map[string]bool
+	blockedMutex sync.RWMutex
+
+	// Last server used for each host, see ServerFor.
+	routes      map[string]string
+	routesMutex sync.RWMutex
+
 	hqfd fronted.Dialer
 	l    net.Listener
 }
@@ -110,6 +129,10 @@ func (client *Client) Configure(cfg *ClientConfig) fronted.Dialer {
 
 	client.initReverseProxy(bal, cfg.DumpHeaders)
 
+	client.configureLANRelay(cfg)
+
+	client.setBlockedSites(cfg.BlockedSites)
+
 	client.priorCfg = cfg
 	client.priorTrustedCAs = &x509.CertPool{}
 	*client.priorTrustedCAs = *globals.TrustedCAs
@@ -123,5 +146,8 @@ func (client *Client) Stop() error {
 	if err := client.hqfd.Close(); err != nil {
 		log.Debugf("Error closing client connection: %s", err)
 	}
+	client.cfgMutex.Lock()
+	client.stopLANRelay()
+	client.cfgMutex.Unlock()
 	return client.l.Close()
 }
@@ -19,6 +19,14 @@ type ClientConfig struct {
 	FrontedServers []*FrontedServerInfo
 	ChainedServers map[string]*ChainedServerInfo
 	MasqueradeSets map[string][]*fronted.Masquerade
+
+	ShareWithLANPeers bool     // Relay traffic for Lantern peers on the local network
+	FindLANPeers      bool     // Look for Lantern peers on the local network that we could proxy through
+	LANRelayAddr      string   // Address on which to accept traffic from LAN peers
+	LANPeers          []string // Relay addresses of LAN peers the user agreed to proxy through
+
+	DirectSites  []string // Sites the user chose to always access directly, bypassing Lantern
+	BlockedSites []string // Sites the user chose to block
 }
 
 // SortServers sorts the Servers array in place, ordered by host
@@ -32,3 +40,10 @@ type ByHost []*FrontedServerInfo
 func (a ByHost) Len() int           { return len(a) }
 func (a ByHost) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByHost) Less(i, j int) bool { return a[i].Host < a[j].Host }
+
+// UsesLANPeers checks whether the user has opted into anything to do with
+// Lantern peers on the local network, which is what it takes for us to do
+// local discovery.
+func (c *ClientConfig) UsesLANPeers() bool {
+	return c.ShareWithLANPeers || c.FindLANPeers || len(c.LANPeers) > 0
+}
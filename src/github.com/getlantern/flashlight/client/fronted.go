@@ -63,7 +63,7 @@ type FrontedServerInfo struct {
 
 // dialer creates a dialer for domain fronting and and balanced dialer that can
 // be used to dial to arbitrary addresses.
-func (s *FrontedServerInfo) dialer(masqueradeSets map[string][]*fronted.Masquerade) (fronted.Dialer, *balancer.Dialer) {
+func (s *FrontedServerInfo) dialer(masqueradeSets map[string][]*fronted.Masquerade, ch *chaos) (fronted.Dialer, *balancer.Dialer) {
 	fd := fronted.NewDialer(fronted.Config{
 		Host:               s.Host,
 		Port:               s.Port,
@@ -77,6 +77,7 @@ func (s *FrontedServerInfo) dialer(masqueradeSets map[string][]*fronted.Masquera
 		Masquerades:        masqueradeSets[s.MasqueradeSet],
 		MaxMasquerades:     s.MaxMasquerades,
 		RootCAs:            globals.TrustedCAs,
+		FailMasquerade:     ch.failMasqueradeFunc(fmt.Sprintf("masquerades for %s:%d", s.Host, s.Port)),
 	})
 
 	var masqueradeQualifier string
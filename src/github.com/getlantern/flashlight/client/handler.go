@@ -24,6 +24,12 @@ const (
 func (client *Client) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	logging.RegisterUserAgent(req.Header.Get("User-Agent"))
 
+	if client.isBlocked(req.Host) {
+		log.Debugf("Refusing %s %s, blocked by user", req.Method, req.Host)
+		resp.WriteHeader(http.StatusForbidden)
+		return
+	}
+
 	if req.Method == httpConnectMethod {
 		// CONNECT requests are often used for HTTPS requests.
 		log.Tracef("Intercepting CONNECT %s", req.URL)
@@ -91,7 +97,7 @@ func (client *Client) intercept(resp http.ResponseWriter, req *http.Request) {
 	// Establish outbound connection.
 	addr := hostIncludingPort(req, 443)
 	d := func(network, addr string) (net.Conn, error) {
-		return client.getBalancer().DialQOS("tcp", addr, client.targetQOS(req))
+		return client.dialQOS(client.getBalancer(), "tcp", addr, client.targetQOS(req))
 	}
 
 	if runtime.GOOS == "android" || client.ProxyAll {
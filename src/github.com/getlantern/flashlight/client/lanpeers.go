@@ -0,0 +1,190 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/getlantern/balancer"
+	"github.com/getlantern/chained"
+)
+
+var (
+	// localNetworks are the address ranges from which we accept connections
+	// to the LAN relay.
+	localNetworks = mustParseCIDRs(
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"169.254.0.0/16",
+		"fc00::/7",
+		"fe80::/10",
+	)
+)
+
+// lanRelay serves proxy requests from Lantern peers on the local network using
+// this Client, allowing peers that have lost connectivity to borrow ours.
+type lanRelay struct {
+	addr string
+	l    net.Listener
+}
+
+// configureLANRelay starts or stops the LAN relay depending on whether or not
+// the user has agreed to share their connection with local peers.
+func (client *Client) configureLANRelay(cfg *ClientConfig) {
+	if client.relay != nil {
+		if cfg.ShareWithLANPeers && client.relay.addr == cfg.LANRelayAddr {
+			log.Trace("LAN relay unchanged")
+			return
+		}
+		client.stopLANRelay()
+	}
+
+	if !cfg.ShareWithLANPeers {
+		return
+	}
+
+	l, err := net.Listen("tcp", cfg.LANRelayAddr)
+	if err != nil {
+		log.Errorf("Unable to listen for LAN peers at %s: %v", cfg.LANRelayAddr, err)
+		return
+	}
+	client.relay = &lanRelay{
+		addr: cfg.LANRelayAddr,
+		l:    l,
+	}
+
+	httpServer := &http.Server{
+		ReadTimeout:  client.ReadTimeout,
+		WriteTimeout: client.WriteTimeout,
+		Handler:      http.HandlerFunc(client.serveLANPeer),
+		ErrorLog:     log.AsStdLogger(),
+	}
+
+	log.Debugf("Relaying for LAN peers at %s", l.Addr())
+	go func() {
+		if err := httpServer.Serve(l); err != nil {
+			log.Debugf("Stopped relaying for LAN peers: %v", err)
+		}
+	}()
+}
+
+func (client *Client) stopLANRelay() {
+	if client.relay == nil {
+		return
+	}
+	log.Debugf("No longer relaying for LAN peers at %s", client.relay.addr)
+	if err := client.relay.l.Close(); err != nil {
+		log.Debugf("Error closing LAN relay listener: %v", err)
+	}
+	client.relay = nil
+}
+
+// serveLANPeer proxies requests for peers, refusing anyone that isn't actually
+// on the local network.
+func (client *Client) serveLANPeer(resp http.ResponseWriter, req *http.Request) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	ip := net.ParseIP(host)
+	if err != nil || ip == nil || !isLocalNetwork(ip) {
+		log.Debugf("Refusing to relay for non-local address %v", req.RemoteAddr)
+		resp.WriteHeader(http.StatusForbidden)
+		return
+	}
+	client.ServeHTTP(resp, req)
+}
+
+// setLANPeers replaces the balancer for LAN peers with one using the given
+// dialers.
+func (client *Client) setLANPeers(dialers []*balancer.Dialer) {
+	var peers *balancer.Balancer
+	if len(dialers) > 0 {
+		peers = balancer.New(dialers...)
+	}
+
+	client.lanPeersMutex.Lock()
+	old := client.lanPeers
+	client.lanPeers = peers
+	client.lanPeersMutex.Unlock()
+
+	if old != nil {
+		// Close old balancer on a goroutine to avoid blocking here
+		go old.Close()
+	}
+}
+
+func (client *Client) getLANPeers() *balancer.Balancer {
+	client.lanPeersMutex.RLock()
+	defer client.lanPeersMutex.RUnlock()
+	return client.lanPeers
+}
+
+// dialQOS dials using the given balancer and only if that fails, falls back
+// to approved LAN peers. Peers are other users' machines, so we only borrow
+// their connectivity when ours is down, and never for plain HTTP.
+func (client *Client) dialQOS(bal *balancer.Balancer, network, addr string, targetQOS int) (net.Conn, error) {
+	conn, err := bal.DialQOS(network, addr, targetQOS)
+	if err == nil {
+		return conn, nil
+	}
+	peers := client.getLANPeers()
+	if peers == nil {
+		return nil, err
+	}
+	if isHTTP(addr) {
+		log.Debugf("Unable to dial %s using our own servers, not falling back to LAN peers since plain HTTP is never relayed through peers: %v", addr, err)
+		return nil, err
+	}
+	log.Debugf("Unable to dial %s using our own servers, falling back to LAN peers: %v", addr, err)
+	return peers.DialQOS(network, addr, targetQOS)
+}
+
+// lanPeerDialer creates a *balancer.Dialer that proxies through the relay of
+// a Lantern peer on the local network.
+func lanPeerDialer(addr string) *balancer.Dialer {
+	netd := &net.Dialer{Timeout: chainedDialTimeout}
+	label := fmt.Sprintf("LAN peer at %s", addr)
+	d := chained.NewDialer(chained.Config{
+		DialServer: func() (net.Conn, error) {
+			return netd.Dial("tcp", addr)
+		},
+		Label: label,
+	})
+
+	// Peers are never trusted with plain HTTP traffic, since they're just
+	// other users on the same network.
+	return &balancer.Dialer{
+		Label:  label,
+		Weight: 100,
+		QOS:    0,
+		Dial:   d.Dial,
+	}
+}
+
+// isHTTP checks whether the given address is likely to carry plain HTTP,
+// using the same ports as the balancer does to decide which traffic needs
+// trusted dialers.
+func isHTTP(addr string) bool {
+	_, port, _ := net.SplitHostPort(addr)
+	return port == "" || port == "80" || port == "8080"
+}
+
+func isLocalNetwork(ip net.IP) bool {
+	for _, n := range localNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to parse CIDR %s: %v", cidr, err))
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getlantern/balancer"
+	"github.com/getlantern/testify/assert"
+)
+
+func TestIsLocalNetwork(t *testing.T) {
+	for _, ip := range []string{"10.1.2.3", "172.16.0.1", "172.31.255.255", "192.168.1.5", "169.254.3.4", "fd00::1", "fe80::1"} {
+		assert.True(t, isLocalNetwork(net.ParseIP(ip)), "%s should be local", ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "172.32.0.1", "192.169.1.1", "127.0.0.1", "2001:4860::8888"} {
+		assert.False(t, isLocalNetwork(net.ParseIP(ip)), "%s should not be local", ip)
+	}
+}
+
+func TestServeLANPeerRejectsNonLocal(t *testing.T) {
+	client := &Client{}
+	for _, remoteAddr := range []string{"8.8.8.8:1234", "[2001:4860::8888]:1234", "127.0.0.1:1234", "garbage"} {
+		req, err := http.NewRequest("CONNECT", "http://www.example.com:443", nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		req.RemoteAddr = remoteAddr
+		resp := httptest.NewRecorder()
+		client.serveLANPeer(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code, "Should have refused to relay for %s", remoteAddr)
+	}
+}
+
+func TestLANPeersOnlyAsFallback(t *testing.T) {
+	var dialed []string
+	dialer := func(label string, fail *bool) *balancer.Dialer {
+		return &balancer.Dialer{
+			Label:  label,
+			Weight: 1,
+			Dial: func(network, addr string) (net.Conn, error) {
+				dialed = append(dialed, label)
+				if *fail {
+					return nil, fmt.Errorf("%s failed", label)
+				}
+				return nil, nil
+			},
+			Check: func() bool {
+				return !*fail
+			},
+		}
+	}
+
+	ownFails := false
+	peerFails := false
+	bal := balancer.New(dialer("own", &ownFails))
+	defer bal.Close()
+	client := &Client{}
+	client.setLANPeers([]*balancer.Dialer{dialer("peer", &peerFails)})
+
+	_, err := client.dialQOS(bal, "tcp", "www.example.com:443", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"own"}, dialed, "Shouldn't use peer while our own servers work")
+
+	dialed = nil
+	ownFails = true
+	_, err = client.dialQOS(bal, "tcp", "www.example.com:443", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"own", "peer"}, dialed, "Should fall back to peer when our own servers fail")
+
+	dialed = nil
+	_, err = client.dialQOS(bal, "tcp", "www.example.com:80", 0)
+	assert.Error(t, err)
+	assert.Empty(t, dialed, "Should never relay plain HTTP through peers")
+
+	client.setLANPeers(nil)
+	_, err = client.dialQOS(bal, "tcp", "www.example.com:443", 0)
+	assert.Error(t, err, "Without peers, failure should be reported")
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"bytes"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"runtime"
@@ -45,10 +46,13 @@ func (client *Client) initReverseProxy(bal *balancer.Balancer, dumpHeaders bool)
 	// challenge is that ReverseProxy reuses connections for
 	// different requests, so we might have to configure different
 	// ReverseProxies for different QOS's or something like that.
+	dial := func(network, addr string) (net.Conn, error) {
+		return client.dialQOS(bal, network, addr, 0)
+	}
 	if runtime.GOOS == "android" || client.ProxyAll {
-		transport.Dial = bal.Dial
+		transport.Dial = dial
 	} else {
-		transport.Dial = detour.Dialer(bal.Dial)
+		transport.Dial = detour.Dialer(dial)
 	}
 
 	rp := &httputil.ReverseProxy{
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"net"
+
+	"github.com/getlantern/balancer"
+)
+
+const (
+	// maxRecordedRoutes caps how many hosts we remember servers for.
+	maxRecordedRoutes = 1000
+)
+
+// ServerFor returns the label of the server that most recently carried
+// traffic for the given host, or "" if we haven't proxied that host.
+func (client *Client) ServerFor(host string) string {
+	client.routesMutex.RLock()
+	defer client.routesMutex.RUnlock()
+	return client.routes[host]
+}
+
+// recordingRoutes wraps the given dialer so that successful dials record which
+// server was used for which host.
+func (client *Client) recordingRoutes(d *balancer.Dialer) *balancer.Dialer {
+	dial := d.Dial
+	d.Dial = func(network, addr string) (net.Conn, error) {
+		conn, err := dial(network, addr)
+		if err == nil {
+			client.recordRoute(addr, d.Label)
+		}
+		return conn, err
+	}
+	return d
+}
+
+func (client *Client) recordRoute(addr string, label string) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	client.routesMutex.Lock()
+	defer client.routesMutex.Unlock()
+	if client.routes == nil || len(client.routes) >= maxRecordedRoutes {
+		client.routes = make(map[string]string)
+	}
+	client.routes[host] = label
+}
@@ -3,10 +3,12 @@ package client
 import (
 	"net"
 
+	"github.com/getlantern/balancer"
 	"github.com/getlantern/bytecounting"
 
 	"github.com/getlantern/flashlight/statreporter"
 	"github.com/getlantern/flashlight/statserver"
+	"github.com/getlantern/flashlight/traffic"
 )
 
 // withStats wraps a connection with stat tracking logic, recording traffic
@@ -38,3 +40,17 @@ func onBytesGotten(bytes int64) {
 	dims := statreporter.CountryDim()
 	dims.Increment("bytesGotten").Add(bytes)
 }
+
+// trackingTraffic wraps the given dialer so that the traffic over its
+// connections shows up in the traffic dashboard.
+func trackingTraffic(d *balancer.Dialer) *balancer.Dialer {
+	dial := d.Dial
+	d.Dial = func(network, addr string) (net.Conn, error) {
+		conn, err := dial(network, addr)
+		if err != nil {
+			return conn, err
+		}
+		return traffic.Track(addr, conn), nil
+	}
+	return d
+}
@@ -0,0 +1,303 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/getlantern/fronted"
+	"github.com/getlantern/yaml"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+const (
+	bundleType       = "LANTERN CONFIG BUNDLE"
+	bundleKeyType    = "EC PRIVATE KEY"
+	bundleKeyFile    = "bundlekey.pem"
+	publicKeyHeader  = "Public-Key"
+	signatureHeader  = "Signature"
+	fingerprintBytes = 16
+
+	// maxCompactServers is how many chained servers a compact bundle includes.
+	// Each one carries a certificate, so more than a couple won't fit in a QR
+	// code.
+	maxCompactServers = 2
+
+	// maxCompactBytes is the most a version 40 QR code with low error
+	// correction can hold in byte mode.
+	maxCompactBytes = 2953
+)
+
+// Bundle is the portion of a Config that is needed to bootstrap a new install
+// without fetching the cloud config. Bundles are exchanged person-to-person
+// as signed, PEM-armored text that can be saved to a file or pasted. Compact
+// bundles only include a couple of chained servers so that they're small
+// enough to fit in a QR code. We don't render QR codes ourselves, the sender
+// turns the compact bundle file into one with a QR generator (for example
+// qrencode -r bundle.pem -o bundle.png) and the recipient pastes the text
+// they scanned into -import-bundle -, which reads the bundle from stdin.
+//
+// Bundles include the auth tokens of chained servers, so they should only be
+// shared with people who may use those servers.
+type Bundle struct {
+	FrontedServers []*client.FrontedServerInfo
+	ChainedServers map[string]*client.ChainedServerInfo
+	MasqueradeSets map[string][]*fronted.Masquerade
+	TrustedCAs     []*CA
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// ExportBundle writes a bundle of the current servers, masquerades and trusted
+// CAs to the given file, signed with this instance's bundle key. If compact is
+// true, the bundle only includes a couple of chained servers. It returns the
+// fingerprint of the signing key, which the recipient needs in order to import
+// the bundle.
+func ExportBundle(cfg *Config, filename string, compact bool) (string, error) {
+	key, err := bundleKey()
+	if err != nil {
+		return "", err
+	}
+	bundle := &Bundle{
+		FrontedServers: cfg.Client.FrontedServers,
+		ChainedServers: cfg.Client.ChainedServers,
+		MasqueradeSets: cfg.Client.MasqueradeSets,
+		TrustedCAs:     cfg.TrustedCAs,
+	}
+	if compact {
+		bundle = compactBundle(bundle)
+	}
+	b, fingerprint, err := encodeBundle(bundle, key)
+	if err != nil {
+		return "", err
+	}
+	if compact && len(b) > maxCompactBytes {
+		return "", fmt.Errorf("Compact bundle is %d bytes, too large for a QR code", len(b))
+	}
+	// The bundle contains auth tokens, so keep it private
+	if err := ioutil.WriteFile(filename, b, 0600); err != nil {
+		return "", fmt.Errorf("Unable to write bundle to %s: %s", filename, err)
+	}
+	return fingerprint, nil
+}
+
+// ImportBundle reads a bundle from the given file and, once its signature is
+// verified, replaces the servers, masquerades and trusted CAs of the current
+// configuration with the ones from the bundle. Only the parts included in the
+// bundle are replaced, so importing a compact bundle keeps the current fronted
+// servers, masquerades and trusted CAs.
+//
+// Since anyone can sign a bundle, the bundle must have been signed by the key
+// with the expectedSigner fingerprint, which the recipient gets from the sender
+// out of band. If filename is -, the bundle is read from stdin. It returns the
+// fingerprint of the key that signed the bundle.
+func ImportBundle(filename string, expectedSigner string) (string, error) {
+	if expectedSigner == "" {
+		return "", fmt.Errorf("The fingerprint of the expected signer is required")
+	}
+	var b []byte
+	var err error
+	if filename == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Unable to read bundle from %s: %s", filename, err)
+	}
+	bundle, fingerprint, err := decodeBundle(b)
+	if err != nil {
+		return "", err
+	}
+	if expectedSigner != fingerprint {
+		return "", fmt.Errorf("Bundle was signed by %s, not by expected signer %s", fingerprint, expectedSigner)
+	}
+	err = Update(func(updated *Config) error {
+		if len(bundle.FrontedServers) == 0 && len(bundle.ChainedServers) == 0 {
+			return fmt.Errorf("Bundle contains no servers")
+		}
+		if len(bundle.FrontedServers) > 0 {
+			updated.Client.FrontedServers = bundle.FrontedServers
+			updated.Client.MasqueradeSets = bundle.MasqueradeSets
+		}
+		if len(bundle.ChainedServers) > 0 {
+			updated.Client.ChainedServers = bundle.ChainedServers
+		}
+		if len(bundle.TrustedCAs) > 0 {
+			updated.TrustedCAs = bundle.TrustedCAs
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to apply bundle: %s", err)
+	}
+	return fingerprint, nil
+}
+
+// compactBundle returns a bundle with only the first few chained servers of
+// the given bundle, which is enough to get the recipient connected without
+// masquerade lists.
+func compactBundle(bundle *Bundle) *Bundle {
+	names := make([]string, 0, len(bundle.ChainedServers))
+	for name := range bundle.ChainedServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > maxCompactServers {
+		names = names[:maxCompactServers]
+	}
+	compact := &Bundle{ChainedServers: make(map[string]*client.ChainedServerInfo, len(names))}
+	for _, name := range names {
+		compact.ChainedServers[name] = bundle.ChainedServers[name]
+	}
+	return compact
+}
+
+// encodeBundle serializes the bundle as gzipped YAML inside of a PEM block
+// whose headers carry the signer's public key and signature.
+func encodeBundle(bundle *Bundle, key *ecdsa.PrivateKey) ([]byte, string, error) {
+	yamlBytes, err := yaml.Marshal(bundle)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to marshal bundle yaml: %s", err)
+	}
+	var compressed bytes.Buffer
+	gzw, err := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to create gzip writer: %s", err)
+	}
+	if _, err := gzw.Write(yamlBytes); err != nil {
+		return nil, "", fmt.Errorf("Unable to compress bundle: %s", err)
+	}
+	if err := gzw.Close(); err != nil {
+		return nil, "", fmt.Errorf("Unable to compress bundle: %s", err)
+	}
+
+	hash := sha256.Sum256(compressed.Bytes())
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to sign bundle: %s", err)
+	}
+	sig, err := asn1.Marshal(ecdsaSignature{r, s})
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to encode signature: %s", err)
+	}
+	pubKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to encode public key: %s", err)
+	}
+
+	block := &pem.Block{
+		Type: bundleType,
+		Headers: map[string]string{
+			publicKeyHeader: base64.StdEncoding.EncodeToString(pubKey),
+			signatureHeader: base64.StdEncoding.EncodeToString(sig),
+		},
+		Bytes: compressed.Bytes(),
+	}
+	return pem.EncodeToMemory(block), fingerprintOf(pubKey), nil
+}
+
+// decodeBundle parses and verifies a bundle produced by encodeBundle, returning
+// the bundle and the fingerprint of the key that signed it.
+func decodeBundle(b []byte) (*Bundle, string, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != bundleType {
+		return nil, "", fmt.Errorf("No %s found", bundleType)
+	}
+	pubKeyBytes, err := base64.StdEncoding.DecodeString(block.Headers[publicKeyHeader])
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to decode public key: %s", err)
+	}
+	pubKey, err := x509.ParsePKIXPublicKey(pubKeyBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to parse public key: %s", err)
+	}
+	ecPubKey, ok := pubKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, "", fmt.Errorf("Bundle not signed with an ECDSA key")
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(block.Headers[signatureHeader])
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to decode signature: %s", err)
+	}
+	var sig ecdsaSignature
+	if _, err := asn1.Unmarshal(sigBytes, &sig); err != nil {
+		return nil, "", fmt.Errorf("Unable to parse signature: %s", err)
+	}
+	hash := sha256.Sum256(block.Bytes)
+	if !ecdsa.Verify(ecPubKey, hash[:], sig.R, sig.S) {
+		return nil, "", fmt.Errorf("Bundle signature is invalid")
+	}
+
+	gzr, err := gzip.NewReader(bytes.NewReader(block.Bytes))
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to open gzip reader: %s", err)
+	}
+	yamlBytes, err := ioutil.ReadAll(gzr)
+	if err != nil {
+		return nil, "", fmt.Errorf("Unable to decompress bundle: %s", err)
+	}
+	bundle := &Bundle{}
+	if err := yaml.Unmarshal(yamlBytes, bundle); err != nil {
+		return nil, "", fmt.Errorf("Unable to unmarshal bundle yaml: %s", err)
+	}
+	return bundle, fingerprintOf(pubKeyBytes), nil
+}
+
+// bundleKey loads this instance's bundle signing key from the config
+// directory, generating it if necessary.
+func bundleKey() (*ecdsa.PrivateKey, error) {
+	filename, err := InConfigDir(bundleKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil || block.Type != bundleKeyType {
+			return nil, fmt.Errorf("No %s found in %s", bundleKeyType, filename)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Unable to read bundle key from %s: %s", filename, err)
+	}
+
+	log.Debugf("Generating bundle key at %s", filename)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to generate bundle key: %s", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to marshal bundle key: %s", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: bundleKeyType, Bytes: der})
+	if err := ioutil.WriteFile(filename, pemBytes, 0600); err != nil {
+		return nil, fmt.Errorf("Unable to save bundle key to %s: %s", filename, err)
+	}
+	return key, nil
+}
+
+// fingerprintOf returns a short, human-comparable fingerprint of the given
+// DER-encoded public key.
+func fingerprintOf(pubKey []byte) string {
+	hash := sha256.Sum256(pubKey)
+	return hex.EncodeToString(hash[:fingerprintBytes])
+}
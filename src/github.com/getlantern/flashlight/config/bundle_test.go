@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/getlantern/fronted"
+	"github.com/getlantern/testify/assert"
+
+	"github.com/getlantern/flashlight/client"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate key: %v", err)
+	}
+
+	bundle := &Bundle{
+		FrontedServers: []*client.FrontedServerInfo{
+			&client.FrontedServerInfo{
+				Host:          "fallbacks.getiantem.org",
+				Port:          443,
+				MasqueradeSet: cloudflare,
+			},
+		},
+		ChainedServers: map[string]*client.ChainedServerInfo{
+			"fallback-1": &client.ChainedServerInfo{
+				Addr:      "1.2.3.4:443",
+				AuthToken: "token",
+			},
+		},
+		MasqueradeSets: map[string][]*fronted.Masquerade{
+			cloudflare: []*fronted.Masquerade{
+				&fronted.Masquerade{Domain: "example.com", IpAddress: "5.6.7.8"},
+			},
+		},
+		TrustedCAs: []*CA{
+			&CA{CommonName: "Test CA", Cert: "cert"},
+		},
+	}
+
+	b, fingerprint, err := encodeBundle(bundle, key)
+	if err != nil {
+		t.Fatalf("Unable to encode bundle: %v", err)
+	}
+
+	decoded, decodedFingerprint, err := decodeBundle(b)
+	if assert.NoError(t, err, "Should be able to decode bundle") {
+		assert.Equal(t, fingerprint, decodedFingerprint, "Fingerprint should match signer")
+		assert.Len(t, fingerprint, 32, "Fingerprint should be 128 bits of hex")
+		assert.Equal(t, bundle, decoded, "Decoded bundle should match original")
+	}
+
+	tampered := bytes.Replace(b, []byte("Signature: "), []byte("Signature: AAAA"), 1)
+	_, _, err = decodeBundle(tampered)
+	assert.Error(t, err, "Tampered bundle should fail to decode")
+
+	_, _, err = decodeBundle([]byte("not a bundle"))
+	assert.Error(t, err, "Garbage should fail to decode")
+}
+
+func TestCompactBundle(t *testing.T) {
+	bundle := &Bundle{
+		FrontedServers: []*client.FrontedServerInfo{
+			&client.FrontedServerInfo{Host: "fallbacks.getiantem.org", Port: 443},
+		},
+		ChainedServers: map[string]*client.ChainedServerInfo{
+			"c": &client.ChainedServerInfo{Addr: "3.3.3.3:443"},
+			"a": &client.ChainedServerInfo{Addr: "1.1.1.1:443"},
+			"b": &client.ChainedServerInfo{Addr: "2.2.2.2:443"},
+		},
+		TrustedCAs: []*CA{
+			&CA{CommonName: "Test CA", Cert: "cert"},
+		},
+	}
+	assert.Equal(t, &Bundle{
+		ChainedServers: map[string]*client.ChainedServerInfo{
+			"a": bundle.ChainedServers["a"],
+			"b": bundle.ChainedServers["b"],
+		},
+	}, compactBundle(bundle), "Compact bundle should only include first chained servers")
+}
+
+func TestImportBundleRequiresSigner(t *testing.T) {
+	_, err := ImportBundle("bundle.pem", "")
+	assert.Error(t, err, "Importing without expected signer should fail")
+}
@@ -52,13 +52,14 @@ type Config struct {
 	CpuProfile    string
 	MemProfile    string
 	UIAddr        string // UI HTTP server address
-	AutoReport    *bool  // Report anonymous usage to GA
+	AutoReport    *bool  // Kept for older UIs, false iff Stats.Tier is none
 	AutoLaunch    *bool  // Automatically launch Lantern on system startup
 	Stats         *statreporter.Config
 	Server        *server.ServerConfig
 	Client        *client.ClientConfig
 	ProxiedSites  *proxiedsites.Config // List of proxied site domains that get routed through Lantern rather than accessed directly
 	TrustedCAs    []*CA
+	Extensions    []string // Origins of Lantern's browser extensions, like chrome-extension://<id>, that may use the routing API
 }
 
 func Configure(c *http.Client) {
@@ -80,9 +81,17 @@ func Init(version string) (*Config, error) {
 		log.Errorf("Could not get config path? %v", err)
 		return nil, err
 	}
+	// Hand-maintained settings go into the overrides file, which unlike the
+	// config file doesn't get rewritten and so keeps its comments.
+	overridesPath, err := InConfigDir("lantern-overrides.yaml")
+	if err != nil {
+		log.Errorf("Could not get overrides path? %v", err)
+		return nil, err
+	}
 	m = &yamlconf.Manager{
-		FilePath:         configPath,
-		FilePollInterval: 1 * time.Second,
+		FilePath:          configPath,
+		FilePollInterval:  1 * time.Second,
+		OverridesFilePath: overridesPath,
 		EmptyConfig: func() yamlconf.Config {
 			return &Config{}
 		},
@@ -232,6 +241,13 @@ func (cfg *Config) ApplyDefaults() {
 		cfg.Stats.StatshubAddr = *statshubAddr
 	}
 
+	if cfg.Stats.Tier == "" {
+		cfg.Stats.Tier = cfg.defaultStatsTier()
+	} else if !statreporter.IsValidTier(cfg.Stats.Tier) {
+		log.Errorf("Unknown privacy tier '%s', not reporting stats", cfg.Stats.Tier)
+		cfg.Stats.Tier = statreporter.TierNone
+	}
+
 	if cfg.Client != nil && cfg.Role == "client" {
 		cfg.applyClientDefaults()
 	}
@@ -314,6 +330,10 @@ func (cfg *Config) applyClientDefaults() {
 		}
 	}
 
+	if cfg.Client.LANRelayAddr == "" {
+		cfg.Client.LANRelayAddr = ":8788"
+	}
+
 	// Always make sure we have a map of ChainedServers
 	if cfg.Client.ChainedServers == nil {
 		cfg.Client.ChainedServers = make(map[string]*client.ChainedServerInfo)
@@ -323,6 +343,19 @@ func (cfg *Config) applyClientDefaults() {
 	cfg.Client.SortServers()
 }
 
+// defaultStatsTier picks the privacy tier for configs that predate tiers.
+// Servers report in detail, clients honor their prior AutoReport choice. Note
+// that the role flag hasn't been applied yet when defaulting a new config.
+func (cfg *Config) defaultStatsTier() string {
+	if cfg.Role == "server" || *role == "server" {
+		return statreporter.TierDetailed
+	}
+	if cfg.AutoReport != nil && !*cfg.AutoReport {
+		return statreporter.TierNone
+	}
+	return statreporter.TierCountry
+}
+
 func (cfg *Config) IsDownstream() bool {
 	return cfg.Role == "client"
 }
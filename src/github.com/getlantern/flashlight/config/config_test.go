@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/getlantern/testify/assert"
+	"github.com/getlantern/yaml"
+
+	"github.com/getlantern/flashlight/statreporter"
+)
+
+func TestUnknownTierReportsNothing(t *testing.T) {
+	cfg := &Config{Stats: &statreporter.Config{Tier: "bogus"}}
+	cfg.ApplyDefaults()
+	assert.Equal(t, statreporter.TierNone, cfg.Stats.Tier, "Unknown tier should be treated as none")
+}
+
+func TestChaosNotSaved(t *testing.T) {
+	// Older versions saved chaos settings passed on the command line
+	cfg := &Config{}
+	if err := yaml.Unmarshal([]byte("client:\n  chaos:\n    dropdialspercent: 50\n"), cfg); !assert.NoError(t, err) {
+		return
+	}
+	b, err := yaml.Marshal(cfg)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(b), "chaos", "Chaos settings should never be saved")
+	}
+}
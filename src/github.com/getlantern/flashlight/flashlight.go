@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -22,15 +23,19 @@ import (
 
 	"github.com/getlantern/flashlight/analytics"
 	"github.com/getlantern/flashlight/autoupdate"
+	"github.com/getlantern/flashlight/cleanup"
 	"github.com/getlantern/flashlight/client"
 	"github.com/getlantern/flashlight/config"
 	"github.com/getlantern/flashlight/geolookup"
+	"github.com/getlantern/flashlight/localdiscovery"
 	"github.com/getlantern/flashlight/logging"
 	"github.com/getlantern/flashlight/proxiedsites"
+	"github.com/getlantern/flashlight/routing"
 	"github.com/getlantern/flashlight/server"
 	"github.com/getlantern/flashlight/settings"
 	"github.com/getlantern/flashlight/statreporter"
 	"github.com/getlantern/flashlight/statserver"
+	"github.com/getlantern/flashlight/traffic"
 	"github.com/getlantern/flashlight/ui"
 	"github.com/getlantern/flashlight/util"
 
@@ -51,6 +56,12 @@ var (
 	headless           = flag.Bool("headless", false, "if true, lantern will run with no ui")
 	startup            = flag.Bool("startup", false, "if true, Lantern was automatically run on system startup")
 	clearProxySettings = flag.Bool("clear-proxy-settings", false, "if true, Lantern removes proxy settings from the system.")
+	cleanupSystem      = flag.Bool("cleanup", false, "if true, Lantern undoes all changes it has made to the system, including launching on startup, and exits")
+	exportBundle       = flag.String("export-bundle", "", "if specified, Lantern writes a signed bundle of its current servers, masquerades and trusted CAs to this file and exits")
+	importBundle       = flag.String("import-bundle", "", "if specified, Lantern replaces its servers, masquerades and trusted CAs with those from the signed bundle in this file (- for stdin, for example to paste a bundle scanned from a QR code) and exits")
+	compactBundle      = flag.Bool("compact-bundle", false, "if true, -export-bundle only includes a couple of chained servers, small enough to turn into a QR code with any QR generator, for example qrencode -r bundle.pem -o bundle.png")
+	bundleSigner       = flag.String("bundle-signer", "", "required for -import-bundle, which only accepts bundles signed by the key with this fingerprint")
+	chaos              = flag.String("chaos", "", "YAML string configuring fault injection for testing failover during this run only (e.g. '{dropdialspercent: 20, diallatencymillis: 500, failmasqueradespercent: 10, seed: 1}'). Never use this in production")
 
 	showui = true
 
@@ -117,6 +128,9 @@ func main() {
 	}
 	// If exitStatus >= 0, then we're the parent process.
 	if exitStatus >= 0 {
+		if exitStatus != 0 {
+			cleanupAfterChild()
+		}
 		os.Exit(exitStatus)
 	}
 
@@ -180,6 +194,9 @@ func doMain() error {
 			exit(err)
 		}
 	}()
+	if *exportBundle != "" || *importBundle != "" {
+		return handleBundle(cfg)
+	}
 	if *help || cfg.Addr == "" || (cfg.Role != "server" && cfg.Role != "client") {
 		flag.Usage()
 		return fmt.Errorf("Wrong arguments")
@@ -204,6 +221,32 @@ func doMain() error {
 	return waitForExit()
 }
 
+// handleBundle exports or imports a configuration bundle, which allows people
+// to bootstrap each other's Lantern when fetching the cloud config is blocked.
+func handleBundle(cfg *config.Config) error {
+	if *exportBundle != "" {
+		fingerprint, err := config.ExportBundle(cfg, *exportBundle, *compactBundle)
+		if err != nil {
+			return fmt.Errorf("Unable to export bundle: %v", err)
+		}
+		fmt.Printf("Exported configuration bundle to %s, signed by %s\n", *exportBundle, fingerprint)
+		return nil
+	}
+	// A running Lantern would overwrite the imported config with its own, so
+	// make sure there isn't one by holding its UI port while we import.
+	l, err := net.Listen("tcp4", cfg.UIAddr)
+	if err != nil {
+		return fmt.Errorf("Unable to import bundle while Lantern is running, please quit it first: %v", err)
+	}
+	defer l.Close()
+	fingerprint, err := config.ImportBundle(*importBundle, *bundleSigner)
+	if err != nil {
+		return fmt.Errorf("Unable to import bundle: %v", err)
+	}
+	fmt.Printf("Imported configuration bundle from %s, signed by %s\n", *importBundle, fingerprint)
+	return nil
+}
+
 func i18nInit() {
 	i18n.SetMessagesFunc(func(filename string) ([]byte, error) {
 		return ui.Translations.Get(filename)
@@ -242,6 +285,19 @@ func runClientProxy(cfg *config.Config) {
 		exit(err)
 	}
 
+	if err := initCleanup(); err != nil {
+		log.Errorf("Unable to initialize cleanup: %v", err)
+	}
+
+	if *cleanupSystem {
+		if err := cleanup.Restore(true); err != nil {
+			exit(err)
+			return
+		}
+		exit(nil)
+		return
+	}
+
 	if *clearProxySettings {
 		// This is a workaround that attempts to fix a Windows-only problem where
 		// Lantern was unable to clean the system's proxy settings before logging
@@ -252,11 +308,19 @@ func runClientProxy(cfg *config.Config) {
 		exit(nil)
 	}
 
+	// Fault injection is only ever for this run, so it's not part of the
+	// config.
+	chaosCfg, err := client.ParseChaos(*chaos)
+	if err != nil {
+		exit(fmt.Errorf("Unable to parse chaos: %v", err))
+	}
+
 	// Create the client-side proxy.
 	client := &client.Client{
 		Addr:         cfg.Addr,
 		ReadTimeout:  0, // don't timeout
 		WriteTimeout: 0,
+		Chaos:        chaosCfg,
 	}
 
 	// Start user interface.
@@ -274,6 +338,24 @@ func runClientProxy(cfg *config.Config) {
 		return
 	}
 
+	// Now that we know we're the only Lantern running, undo whatever changes a
+	// previous run left behind when it was killed.
+	if err := cleanup.Restore(false); err != nil {
+		log.Errorf("Unable to clean up after previous run: %v", err)
+	}
+
+	// Once the user opts into using LAN peers, continually search for local
+	// Lantern instances and update the UI. If we're headless, advertise our UI
+	// so that it can be found from elsewhere.
+	localdiscovery.Start(!showui, strconv.Itoa(tcpAddr.Port))
+	addExitFunc(localdiscovery.Stop)
+
+	// Tell browser extensions how we're routing their sites.
+	routing.Start(client.ServerFor, isDirectHost)
+
+	// Stream traffic metrics to the UI's dashboard.
+	traffic.Start()
+
 	applyClientConfig(client, cfg)
 	// Continually poll for config updates and update client accordingly
 	go func() {
@@ -283,16 +365,6 @@ func runClientProxy(cfg *config.Config) {
 		}
 	}()
 
-	/*
-		      Temporarily disabling localdiscover. See:
-		      https://github.com/getlantern/lantern/issues/2813
-		      // Continually search for local Lantern instances and update the UI
-		      go func() {
-			addExitFunc(localdiscovery.Stop)
-			localdiscovery.Start(!showui, strconv.Itoa(tcpAddr.Port))
-		      }()
-	*/
-
 	// watchDirectAddrs will spawn a goroutine that will add any site that is
 	// directly accesible to the PAC file.
 	watchDirectAddrs()
@@ -345,8 +417,12 @@ func applyClientConfig(client *client.Client, cfg *config.Config) {
 		version, revisionDate)
 	settings.Configure(cfg, version, revisionDate, buildDate)
 	proxiedsites.Configure(cfg.ProxiedSites)
+	localdiscovery.Configure(cfg)
+	routing.Configure(cfg)
+	recordLaunchItem(cfg)
 	analytics.Configure(cfg, version)
 	log.Debugf("Proxy all traffic or not: %v", cfg.Client.ProxyAll)
+	setUserSites(cfg.Client.DirectSites, cfg.Client.BlockedSites)
 	ServeProxyAllPacFile(cfg.Client.ProxyAll)
 	// Note - we deliberately ignore the error from statreporter.Configure here
 	_ = statreporter.Configure(cfg.Stats)
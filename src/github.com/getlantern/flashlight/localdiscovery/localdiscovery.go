@@ -1,33 +1,69 @@
 // Package localdiscovery provides a service for discovering Lantern instances
-// in the local network
+// in the local network.
+//
+// Discovery was disabled for everyone because of
+// https://github.com/getlantern/lantern/issues/2813, so we only join the
+// multicast group while the user has opted into using LAN peers.
 package localdiscovery
 
 import (
+	"encoding/json"
+	"net"
 	"sync"
 
-	"github.com/getlantern/flashlight/ui"
 	"github.com/getlantern/golog"
 	"github.com/getlantern/multicast"
+
+	"github.com/getlantern/flashlight/config"
+	"github.com/getlantern/flashlight/ui"
 )
 
 const (
-	messageType  = `LocalDiscovery`
+	messageType = `LocalDiscovery`
 )
 
 var (
-	log           = golog.LoggerFor("flashlight.localdiscovery")
-	service       *ui.Service
-	mc            *multicast.Multicast
-	lastPeers     []multicast.PeerInfo
-	peersMutex    sync.Mutex
+	log        = golog.LoggerFor("flashlight.localdiscovery")
+	service    *ui.Service
+	mc         *multicast.Multicast
+	lastPeers  []multicast.PeerInfo
+	approved   = make(map[string]bool)
+	peersMutex sync.Mutex
+
+	cfgMutex  sync.Mutex
+	enabled   bool
+	advertise bool
+	uiPort    string
+	relayPort string // only set while sharing with LAN peers
 )
 
-// Start begins the local Lantern discovery process
-func Start(advertise bool, portToAdvertise string) {
+// payload is what we advertise to other Lantern instances via multicast.
+type payload struct {
+	UIPort    string
+	RelayPort string `json:",omitempty"`
+}
+
+// Peer is a Lantern instance on the local network, as presented to the UI.
+type Peer struct {
+	// UI: the URL of the peer's UI, if it advertises one
+	UI string
+
+	// Relay: the host:port through which we can proxy via this peer, if the
+	// peer is sharing its connection
+	Relay string
+
+	// Approved: whether the user has agreed to proxy through this peer
+	Approved bool
+}
+
+// Start registers the local discovery UI service. Discovery itself only starts
+// once Configure finds that the user opted into using LAN peers. If advertise
+// is true, we then announce our UI on the local network. Independently of that,
+// we announce our relay whenever the user has agreed to share with LAN peers.
+func Start(shouldAdvertise bool, portToAdvertise string) {
 	if service != nil {
 		// Dev error: this service shouldn't be started unless stopped
 		panic("The " + messageType + " service is already registered")
-		return
 	}
 
 	var err error
@@ -40,39 +76,175 @@ func Start(advertise bool, portToAdvertise string) {
 		log.Errorf("Unable to register Local Discovery service: %q", err)
 		return
 	}
+	go read()
+
+	cfgMutex.Lock()
+	advertise = shouldAdvertise
+	uiPort = portToAdvertise
+	cfgMutex.Unlock()
+}
+
+// Configure starts or stops discovery and updates the relays we advertise and
+// the peers that we've been approved to use based on the given configuration.
+func Configure(cfg *config.Config) {
+	cfgMutex.Lock()
+	defer cfgMutex.Unlock()
+
+	peersMutex.Lock()
+	approved = make(map[string]bool, len(cfg.Client.LANPeers))
+	for _, addr := range cfg.Client.LANPeers {
+		approved[addr] = true
+	}
+	peersMutex.Unlock()
+
+	newRelayPort := ""
+	if cfg.Client.ShareWithLANPeers {
+		_, port, err := net.SplitHostPort(cfg.Client.LANRelayAddr)
+		if err != nil {
+			log.Errorf("Unable to determine port of LAN relay at %s: %v", cfg.Client.LANRelayAddr, err)
+		} else {
+			newRelayPort = port
+		}
+	}
+	newEnabled := cfg.Client.UsesLANPeers()
+	if newEnabled != enabled || newRelayPort != relayPort {
+		enabled = newEnabled
+		relayPort = newRelayPort
+		// Payload can't be changed once multicasting, so rejoin
+		leave()
+		if enabled {
+			log.Debugf("Discovering LAN peers, advertising relay port '%s'", relayPort)
+			join()
+		} else {
+			log.Debug("Not discovering LAN peers")
+		}
+	}
 
+	if service != nil {
+		service.Out <- buildPeersList()
+	}
+}
+
+// Stop quits the local Lantern discovery process
+func Stop() {
+	cfgMutex.Lock()
+	leave()
+	cfgMutex.Unlock()
+
+	ui.Unregister(messageType)
+	service = nil
+}
+
+// join joins the multicast group, advertising ourselves if appropriate. Must
+// be called while holding cfgMutex.
+func join() {
 	addOrRemoveCb := func(peer string, peersInfo []multicast.PeerInfo) {
 		peersMutex.Lock()
 		lastPeers = peersInfo
 		peersMutex.Unlock()
 
-		service.Out <- buildPeersList()
+		if service != nil {
+			service.Out <- buildPeersList()
+		}
 	}
 	mc = multicast.JoinMulticast(addOrRemoveCb, addOrRemoveCb)
+	if mc == nil {
+		log.Error("Unable to join multicast group, not discovering LAN peers")
+		return
+	}
 
-	if advertise {
-		mc.SetPayload(portToAdvertise)
-		mc.StartMulticast()
+	if advertise || relayPort != "" {
+		b, err := json.Marshal(&payload{
+			UIPort:    uiPort,
+			RelayPort: relayPort,
+		})
+		if err != nil {
+			log.Errorf("Unable to marshal multicast payload: %v", err)
+		} else {
+			mc.SetPayload(string(b))
+			mc.StartMulticast()
+		}
 	}
 
 	mc.ListenPeers()
 }
 
-// Stop quits the local Lantern discovery process
-func Stop() {
-	ui.Unregister(messageType)
-	service = nil
+// leave leaves the multicast group and forgets the peers we found. Must be
+// called while holding cfgMutex.
+func leave() {
+	if mc == nil {
+		return
+	}
 	mc.LeaveMulticast()
+	mc = nil
+
+	peersMutex.Lock()
+	lastPeers = nil
+	peersMutex.Unlock()
 }
 
-func buildPeersList() []string {
-	peersList := make([]string, len(lastPeers))
+// read processes messages from the UI approving or revoking the use of a
+// peer's relay, for example {"approve": "192.168.1.5:8788"}.
+func read() {
+	for msg := range service.In {
+		m := (msg).(map[string]interface{})
+		err := config.Update(func(updated *config.Config) error {
+			if addr, ok := m["approve"].(string); ok && !contains(updated.Client.LANPeers, addr) {
+				log.Debugf("User approved LAN peer at %s", addr)
+				updated.Client.LANPeers = append(updated.Client.LANPeers, addr)
+			} else if addr, ok := m["revoke"].(string); ok {
+				log.Debugf("User revoked LAN peer at %s", addr)
+				updated.Client.LANPeers = without(updated.Client.LANPeers, addr)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("Unable to update LAN peers: %v", err)
+		}
+	}
+}
 
+func buildPeersList() []*Peer {
 	peersMutex.Lock()
-	for i, peer := range lastPeers {
-		peersList[i] = "http://" + peer.IP.String() + ":" + peer.Payload
+	defer peersMutex.Unlock()
+
+	peersList := make([]*Peer, 0, len(lastPeers))
+	for _, peer := range lastPeers {
+		var p payload
+		if err := json.Unmarshal([]byte(peer.Payload), &p); err != nil {
+			// Older Lanterns advertise just their UI port
+			p.UIPort = peer.Payload
+		}
+		host := peer.IP.String()
+		info := &Peer{}
+		if p.UIPort != "" {
+			info.UI = "http://" + net.JoinHostPort(host, p.UIPort)
+		}
+		if p.RelayPort != "" {
+			info.Relay = net.JoinHostPort(host, p.RelayPort)
+			info.Approved = approved[info.Relay]
+		}
+		peersList = append(peersList, info)
 	}
-	peersMutex.Unlock()
 
 	return peersList
 }
+
+func contains(addrs []string, addr string) bool {
+	for _, a := range addrs {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func without(addrs []string, addr string) []string {
+	result := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if a != addr {
+			result = append(result, a)
+		}
+	}
+	return result
+}
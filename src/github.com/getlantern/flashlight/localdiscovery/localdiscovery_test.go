@@ -0,0 +1,28 @@
+package localdiscovery
+
+import (
+	"net"
+	"testing"
+
+	"github.com/getlantern/multicast"
+	"github.com/getlantern/testify/assert"
+)
+
+func TestBuildPeersList(t *testing.T) {
+	lastPeers = []multicast.PeerInfo{
+		{IP: net.ParseIP("192.168.1.5"), Payload: `{"UIPort":"16823","RelayPort":"8788"}`},
+		{IP: net.ParseIP("192.168.1.6"), Payload: `{"RelayPort":"8788"}`},
+		{IP: net.ParseIP("192.168.1.7"), Payload: "16823"},
+	}
+	approved = map[string]bool{"192.168.1.6:8788": true}
+	defer func() {
+		lastPeers = nil
+		approved = make(map[string]bool)
+	}()
+
+	assert.Equal(t, []*Peer{
+		{UI: "http://192.168.1.5:16823", Relay: "192.168.1.5:8788"},
+		{Relay: "192.168.1.6:8788", Approved: true},
+		{UI: "http://192.168.1.7:16823"},
+	}, buildPeersList(), "Should understand both JSON and legacy bare port payloads")
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"path/filepath"
+	"reflect"
 	"runtime"
-	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/getlantern/filepersist"
 	"github.com/getlantern/pac"
 
+	"github.com/getlantern/flashlight/cleanup"
 	"github.com/getlantern/flashlight/ui"
 )
 
@@ -24,7 +26,12 @@ var (
 	muPACFile   sync.RWMutex
 	pacFile     []byte
 	directHosts = make(map[string]bool)
-	proxyAll    = int32(0)
+	// Sites the user chose to access directly or to block, which take
+	// precedence over directHosts and proxy all
+	userDirectHosts = make(map[string]bool)
+	blockedHosts    = make(map[string]bool)
+	muDirect        sync.RWMutex
+	proxyAll        = int32(0)
 )
 
 func ServeProxyAllPacFile(b bool) {
@@ -36,6 +43,35 @@ func ServeProxyAllPacFile(b bool) {
 	genPACFile()
 }
 
+// setUserSites updates the sites that the user chose to access directly or to
+// block, reapplying the PAC file if they changed so that browsers pick up the
+// change.
+func setUserSites(direct []string, blocked []string) {
+	directSet := toSet(direct)
+	blockedSet := toSet(blocked)
+	muDirect.Lock()
+	changed := !reflect.DeepEqual(directSet, userDirectHosts) || !reflect.DeepEqual(blockedSet, blockedHosts)
+	userDirectHosts = directSet
+	blockedHosts = blockedSet
+	muDirect.Unlock()
+	if !changed {
+		return
+	}
+	genPACFile()
+	if atomic.LoadInt32(&isPacOn) == 1 {
+		doPACOff(pacURL)
+		doPACOn(pacURL)
+	}
+}
+
+func toSet(hosts []string) map[string]bool {
+	set := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		set[host] = true
+	}
+	return set
+}
+
 func setUpPacTool() error {
 	var iconFile string
 	if runtime.GOOS == "darwin" {
@@ -66,16 +102,28 @@ func setProxyAddr(addr string) {
 }
 
 func genPACFile() {
-	hostsString := "[]"
-	// only bypass sites if proxy all option is unset
+	hosts := []string{}
+	muDirect.RLock()
+	for k, v := range userDirectHosts {
+		if v {
+			hosts = append(hosts, k)
+		}
+	}
+	// only bypass other sites if proxy all option is unset
 	if atomic.LoadInt32(&proxyAll) == 0 {
-		var hosts []string
 		for k, v := range directHosts {
-			if v {
+			if v && !userDirectHosts[k] && !blockedHosts[k] {
 				hosts = append(hosts, k)
 			}
 		}
-		hostsString = "['" + strings.Join(hosts, "', '") + "']"
+	}
+	muDirect.RUnlock()
+	// Hosts come from the config, which may have been edited by hand, so
+	// escape them to keep them from breaking the PAC file
+	hostsJSON, err := json.Marshal(hosts)
+	if err != nil {
+		log.Errorf("Unable to encode direct hosts for PAC file: %v", err)
+		hostsJSON = []byte("[]")
 	}
 	formatter :=
 		`var bypassDomains = %s;
@@ -101,7 +149,7 @@ func genPACFile() {
 			return "PROXY %s; DIRECT";
 		}`
 	muPACFile.Lock()
-	pacFile = []byte(fmt.Sprintf(formatter, hostsString, proxyAddr))
+	pacFile = []byte(fmt.Sprintf(formatter, hostsJSON, proxyAddr))
 	muPACFile.Unlock()
 }
 
@@ -118,8 +166,10 @@ func watchDirectAddrs() {
 			if err != nil {
 				panic("watchDirectAddrs() got malformated host:port pair")
 			}
-			if !directHosts[host] {
+			if !isDirectHost(host) {
+				muDirect.Lock()
 				directHosts[host] = true
+				muDirect.Unlock()
 				genPACFile()
 				// reapply so browser will fetch the PAC URL again
 				doPACOff(pacURL)
@@ -129,6 +179,20 @@ func watchDirectAddrs() {
 	}()
 }
 
+// isDirectHost checks whether the PAC file tells the system to bypass Lantern
+// for the given host.
+func isDirectHost(host string) bool {
+	muDirect.RLock()
+	defer muDirect.RUnlock()
+	if userDirectHosts[host] {
+		return true
+	}
+	if blockedHosts[host] || atomic.LoadInt32(&proxyAll) == 1 {
+		return false
+	}
+	return directHosts[host]
+}
+
 func pacOn() {
 	log.Debug("Setting lantern as system proxy")
 	handler := func(resp http.ResponseWriter, req *http.Request) {
@@ -143,6 +207,7 @@ func pacOn() {
 	genPACFile()
 	pacURL = ui.Handle("/proxy_on.pac", http.HandlerFunc(handler))
 	log.Debugf("Serving PAC file at %v", pacURL)
+	cleanup.Record(cleanup.SystemProxy, pacURL, false)
 	doPACOn(pacURL)
 	atomic.StoreInt32(&isPacOn, 1)
 }
@@ -151,6 +216,7 @@ func pacOff() {
 	if atomic.CompareAndSwapInt32(&isPacOn, 1, 0) {
 		log.Debug("Unsetting lantern as system proxy")
 		doPACOff(pacURL)
+		cleanup.Done(cleanup.SystemProxy, pacURL)
 		log.Debug("Unset lantern as system proxy")
 	}
 }
@@ -0,0 +1,282 @@
+// Package routing provides a local API, used by Lantern's browser extensions
+// (see Config.Extensions), that
+// reports how flashlight routes traffic to a given host and that allows
+// overriding that routing via the user's proxied, direct and blocked sites.
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/getlantern/detour"
+	"github.com/getlantern/golog"
+
+	"github.com/getlantern/flashlight/config"
+	"github.com/getlantern/flashlight/ui"
+)
+
+const (
+	// Route values
+	Proxy  = "proxy"  // always proxied
+	Direct = "direct" // never proxied
+	Detour = "detour" // tried directly first, proxied if that appears blocked
+	Block  = "block"  // refused
+
+	// Override values, in addition to Proxy, Direct and Block
+	Auto = "auto" // remove any user override
+
+	path = "/routing"
+)
+
+var (
+	log = golog.LoggerFor("flashlight.routing")
+
+	cfgMutex  sync.RWMutex
+	proxyAll  bool
+	additions map[string]bool
+	deletions map[string]bool
+	direct    map[string]bool
+	blocked   map[string]bool
+
+	serverFor  func(host string) string
+	isBypassed func(host string) bool
+
+	// extensionOrigins are the origins of Lantern's own extensions, the only
+	// origins from which we accept requests. Neither regular web pages nor
+	// other extensions may see or change how we route traffic.
+	extensionOrigins map[string]bool
+
+	validHost = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+)
+
+// Decision describes how flashlight routes traffic to a host.
+type Decision struct {
+	Host string
+
+	// Route: one of proxy, direct, detour or block
+	Route string
+
+	// Server: the server that most recently carried traffic for this host
+	Server string `json:",omitempty"`
+
+	// Override: the user's override for this host (proxy, direct or block), if
+	// any
+	Override string `json:",omitempty"`
+}
+
+// Override is a request to change how traffic to a host is routed.
+type Override struct {
+	Host string
+
+	// Route: one of proxy, direct, block or auto. Proxy adds the host to the
+	// user's proxied sites. Direct removes it from there and adds it to the
+	// sites that the PAC file sends directly, bypassing flashlight. Block adds
+	// it to the sites that flashlight refuses to proxy. Auto clears any earlier
+	// override.
+	Route string
+}
+
+// Start starts serving routing decisions on the UI server. serverForFn reports
+// the last server used for a host and bypassedFn reports whether the system
+// proxy configuration sends a host directly, bypassing flashlight entirely.
+func Start(serverForFn func(host string) string, bypassedFn func(host string) bool) string {
+	cfgMutex.Lock()
+	serverFor = serverForFn
+	isBypassed = bypassedFn
+	cfgMutex.Unlock()
+
+	url := ui.Handle(path, http.HandlerFunc(handle))
+	log.Debugf("Serving routing decisions at %v", url)
+	return url
+}
+
+// Configure updates the routing information from the given configuration.
+func Configure(cfg *config.Config) {
+	cfgMutex.Lock()
+	defer cfgMutex.Unlock()
+
+	proxyAll = cfg.Client.ProxyAll
+	additions = toSet(cfg.ProxiedSites.Delta.Additions)
+	deletions = toSet(cfg.ProxiedSites.Delta.Deletions)
+	direct = toSet(cfg.Client.DirectSites)
+	blocked = toSet(cfg.Client.BlockedSites)
+	extensionOrigins = toSet(cfg.Extensions)
+}
+
+// Decide determines how traffic to the given host is routed.
+func Decide(host string) *Decision {
+	cfgMutex.RLock()
+	defer cfgMutex.RUnlock()
+
+	d := &Decision{Host: host}
+	switch {
+	case blocked[host]:
+		d.Override = Block
+	case direct[host]:
+		d.Override = Direct
+	case additions[host]:
+		d.Override = Proxy
+	}
+
+	switch {
+	case blocked[host]:
+		d.Route = Block
+	case isLocal(host) || direct[host] || (isBypassed != nil && isBypassed(host)):
+		d.Route = Direct
+	case proxyAll || runtime.GOOS == "android":
+		d.Route = Proxy
+	case detour.Whitelisted(host+":443") || detour.Whitelisted(host+":80"):
+		d.Route = Proxy
+	default:
+		d.Route = Detour
+	}
+
+	if (d.Route == Proxy || d.Route == Detour) && serverFor != nil {
+		d.Server = serverFor(host)
+	}
+	return d
+}
+
+// Apply applies the given override to the user's proxied sites.
+func Apply(o *Override) error {
+	host := strings.ToLower(strings.TrimSpace(o.Host))
+	if host == "" {
+		return fmt.Errorf("No host specified")
+	}
+	if net.ParseIP(host) == nil && !validHost.MatchString(host) {
+		return fmt.Errorf("Invalid host %v", host)
+	}
+	if o.Route != Proxy && o.Route != Direct && o.Route != Block && o.Route != Auto {
+		return fmt.Errorf("Unknown route %v", o.Route)
+	}
+
+	return config.Update(func(updated *config.Config) error {
+		delta := updated.ProxiedSites.Delta
+		delta.Additions = without(delta.Additions, host)
+		delta.Deletions = without(delta.Deletions, host)
+		updated.Client.DirectSites = without(updated.Client.DirectSites, host)
+		updated.Client.BlockedSites = without(updated.Client.BlockedSites, host)
+		switch o.Route {
+		case Proxy:
+			delta.Additions = append(delta.Additions, host)
+		case Direct:
+			delta.Deletions = append(delta.Deletions, host)
+			updated.Client.DirectSites = append(updated.Client.DirectSites, host)
+		case Block:
+			updated.Client.BlockedSites = append(updated.Client.BlockedSites, host)
+		}
+		log.Debugf("Routing %v via %v", host, o.Route)
+		return nil
+	})
+}
+
+func handle(resp http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if origin != "" {
+		if !isLanternExtension(origin) {
+			log.Debugf("Refusing routing request from %v", origin)
+			resp.WriteHeader(http.StatusForbidden)
+			return
+		}
+		resp.Header().Set("Access-Control-Allow-Origin", origin)
+		resp.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+		resp.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	}
+
+	switch req.Method {
+	case "OPTIONS":
+		resp.WriteHeader(http.StatusOK)
+	case "GET":
+		host := req.URL.Query().Get("host")
+		if host == "" {
+			http.Error(resp, "Please specify a host", http.StatusBadRequest)
+			return
+		}
+		writeDecision(resp, hostOf(host))
+	case "POST":
+		o := &Override{}
+		if err := json.NewDecoder(req.Body).Decode(o); err != nil {
+			http.Error(resp, fmt.Sprintf("Unable to decode override: %v", err), http.StatusBadRequest)
+			return
+		}
+		o.Host = hostOf(o.Host)
+		if err := Apply(o); err != nil {
+			http.Error(resp, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeDecision(resp, o.Host)
+	default:
+		http.Error(resp, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeDecision(resp http.ResponseWriter, host string) {
+	resp.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(resp).Encode(Decide(host)); err != nil {
+		log.Debugf("Unable to write routing decision: %v", err)
+	}
+}
+
+// hostOf extracts the host from what may be a URL or a host:port.
+func hostOf(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if i := strings.IndexAny(s, "/?#"); i >= 0 {
+		s = s[:i]
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return s
+}
+
+// isLocal mirrors the checks in our PAC file for hosts that are always
+// accessed directly.
+func isLocal(host string) bool {
+	if !strings.Contains(host, ".") || strings.HasSuffix(host, ".local") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/24"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLanternExtension(origin string) bool {
+	cfgMutex.RLock()
+	defer cfgMutex.RUnlock()
+	return extensionOrigins[origin]
+}
+
+func toSet(hosts []string) map[string]bool {
+	set := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		set[host] = true
+	}
+	return set
+}
+
+func without(hosts []string, host string) []string {
+	result := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h != host {
+			result = append(result, h)
+		}
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package routing
+
+import (
+	"testing"
+
+	"github.com/getlantern/detour"
+	"github.com/getlantern/testify/assert"
+)
+
+func TestHostOf(t *testing.T) {
+	assert.Equal(t, "www.example.com", hostOf("https://www.Example.com/path?q=1"))
+	assert.Equal(t, "www.example.com", hostOf("www.example.com:443"))
+	assert.Equal(t, "www.example.com", hostOf(" www.example.com "))
+	assert.Equal(t, "1.2.3.4", hostOf("http://1.2.3.4:8080/"))
+}
+
+func TestDecide(t *testing.T) {
+	additions = toSet([]string{"proxied.com"})
+	deletions = toSet([]string{"unproxied.com"})
+	direct = toSet([]string{"direct.com"})
+	blocked = toSet([]string{"blocked.com"})
+	serverFor = func(host string) string {
+		return "server for " + host
+	}
+	isBypassed = func(host string) bool {
+		return host == "bypassed.com"
+	}
+	detour.AddToWl("proxied.com:443", true)
+	defer detour.RemoveFromWl("proxied.com:443")
+
+	d := Decide("proxied.com")
+	assert.Equal(t, Proxy, d.Route)
+	assert.Equal(t, Proxy, d.Override)
+	assert.Equal(t, "server for proxied.com", d.Server)
+
+	d = Decide("www.proxied.com")
+	assert.Equal(t, Proxy, d.Route, "Subdomains of proxied sites should be proxied")
+	assert.Equal(t, "", d.Override)
+
+	d = Decide("unproxied.com")
+	assert.Equal(t, Detour, d.Route, "Sites removed from proxied sites should be detoured")
+	assert.Equal(t, "", d.Override)
+
+	d = Decide("direct.com")
+	assert.Equal(t, Direct, d.Route)
+	assert.Equal(t, Direct, d.Override)
+	assert.Equal(t, "", d.Server, "Direct hosts should have no server")
+
+	d = Decide("blocked.com")
+	assert.Equal(t, Block, d.Route)
+	assert.Equal(t, Block, d.Override)
+	assert.Equal(t, "", d.Server, "Blocked hosts should have no server")
+
+	d = Decide("bypassed.com")
+	assert.Equal(t, Direct, d.Route)
+	assert.Equal(t, "", d.Server, "Direct hosts should have no server")
+
+	assert.Equal(t, Direct, Decide("192.168.1.1").Route)
+	assert.Equal(t, Direct, Decide("printer.local").Route)
+
+	proxyAll = true
+	defer func() { proxyAll = false }()
+	assert.Equal(t, Proxy, Decide("unproxied.com").Route, "Everything should be proxied when proxying all")
+	assert.Equal(t, Direct, Decide("direct.com").Route, "User's direct sites should be direct even when proxying all")
+	assert.Equal(t, Block, Decide("blocked.com").Route, "User's blocked sites should be blocked even when proxying all")
+}
+
+func TestApplyRejectsInvalidHosts(t *testing.T) {
+	for _, host := range []string{"evil.com'];alert(1);//", "evil com", "-evil.com", "evil..com"} {
+		assert.Error(t, Apply(&Override{Host: host, Route: Direct}), "Should reject %v", host)
+	}
+}
+
+func TestOnlyLanternExtensions(t *testing.T) {
+	extensionOrigins = toSet([]string{"chrome-extension://lantern"})
+	defer func() { extensionOrigins = nil }()
+	assert.True(t, isLanternExtension("chrome-extension://lantern"))
+	assert.False(t, isLanternExtension("chrome-extension://other"), "Other extensions shouldn't be allowed")
+	assert.False(t, isLanternExtension("https://www.example.com"), "Web pages shouldn't be allowed")
+}
@@ -2,12 +2,14 @@
 package settings
 
 import (
+	"fmt"
 	"net/http"
 	"sync"
 
 	"github.com/getlantern/flashlight/config"
 	"github.com/getlantern/launcher"
 
+	"github.com/getlantern/flashlight/statreporter"
 	"github.com/getlantern/flashlight/ui"
 	"github.com/getlantern/golog"
 )
@@ -32,6 +34,11 @@ type Settings struct {
 	AutoReport   bool
 	AutoLaunch   bool
 	ProxyAll     bool
+
+	ReportingTier string
+
+	ShareWithLANPeers bool
+	FindLANPeers      bool
 }
 
 func Configure(cfg *config.Config, version, revisionDate string, buildDate string) {
@@ -48,6 +55,10 @@ func Configure(cfg *config.Config, version, revisionDate string, buildDate strin
 			AutoReport:   *cfg.AutoReport,
 			AutoLaunch:   *cfg.AutoLaunch,
 			ProxyAll:     cfg.Client.ProxyAll,
+
+			ReportingTier:     cfg.Stats.Tier,
+			ShareWithLANPeers: cfg.Client.ShareWithLANPeers,
+			FindLANPeers:      cfg.Client.FindLANPeers,
 		}
 
 		err := start(baseSettings)
@@ -64,6 +75,9 @@ func Configure(cfg *config.Config, version, revisionDate string, buildDate strin
 		baseSettings.AutoReport = *cfg.AutoReport
 		baseSettings.AutoLaunch = *cfg.AutoLaunch
 		baseSettings.ProxyAll = cfg.Client.ProxyAll
+		baseSettings.ReportingTier = cfg.Stats.Tier
+		baseSettings.ShareWithLANPeers = cfg.Client.ShareWithLANPeers
+		baseSettings.FindLANPeers = cfg.Client.FindLANPeers
 	}
 }
 
@@ -91,8 +105,17 @@ func read() {
 		err := config.Update(func(updated *config.Config) error {
 
 			if autoReport, ok := settings["autoReport"].(bool); ok {
-				baseSettings.AutoReport = autoReport
-				*updated.AutoReport = autoReport
+				// AutoReport is kept for older UIs and maps onto tiers
+				tier := statreporter.TierNone
+				if autoReport {
+					tier = statreporter.TierCountry
+				}
+				setReportingTier(updated, tier)
+			} else if tier, ok := settings["reportingTier"].(string); ok {
+				if !statreporter.IsValidTier(tier) {
+					return fmt.Errorf("Unknown reporting tier '%s'", tier)
+				}
+				setReportingTier(updated, tier)
 			} else if proxyAll, ok := settings["proxyAll"].(bool); ok {
 				baseSettings.ProxyAll = proxyAll
 				updated.Client.ProxyAll = proxyAll
@@ -100,6 +123,12 @@ func read() {
 				launcher.CreateLaunchFile(autoLaunch)
 				baseSettings.AutoLaunch = autoLaunch
 				*updated.AutoLaunch = autoLaunch
+			} else if share, ok := settings["shareWithLANPeers"].(bool); ok {
+				baseSettings.ShareWithLANPeers = share
+				updated.Client.ShareWithLANPeers = share
+			} else if find, ok := settings["findLANPeers"].(bool); ok {
+				baseSettings.FindLANPeers = find
+				updated.Client.FindLANPeers = find
 			}
 			return nil
 		})
@@ -108,3 +137,12 @@ func read() {
 		}
 	}
 }
+
+// setReportingTier updates the privacy tier for stats reporting, keeping
+// AutoReport in sync with it.
+func setReportingTier(updated *config.Config, tier string) {
+	baseSettings.ReportingTier = tier
+	baseSettings.AutoReport = tier != statreporter.TierNone
+	updated.Stats.Tier = tier
+	*updated.AutoReport = baseSettings.AutoReport
+}
@@ -0,0 +1,80 @@
+package statreporter
+
+import (
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/getlantern/flashlight/globals"
+)
+
+// Privacy tiers determine how much detail we report, in increasing order of
+// detail. Each tier is enforced here, centrally, by stripping the dimensions
+// and fields of every update that the tier doesn't permit.
+const (
+	// TierNone: report nothing at all
+	TierNone = "none"
+
+	// TierAnonymous: report only aggregate counts, without any dimensions or
+	// instance id
+	TierAnonymous = "anonymous"
+
+	// TierCountry: report aggregate counts broken down by country only,
+	// without instance id
+	TierCountry = "country"
+
+	// TierDetailed: report all dimensions, gauges and distinct members, which
+	// is useful for diagnosing problems
+	TierDetailed = "detailed"
+)
+
+// IsValidTier checks whether the given tier is one of the known tiers.
+func IsValidTier(tier string) bool {
+	switch tier {
+	case TierNone, TierAnonymous, TierCountry, TierDetailed:
+		return true
+	}
+	return false
+}
+
+// reportId returns the id under which to post a report at the given tier. Only
+// detailed reports are posted under our instance id, other reports get a new
+// random id every time so that they can't be linked to this instance or to
+// each other.
+func reportId(tier string) string {
+	if tier == TierDetailed {
+		return globals.InstanceId
+	}
+	return uuid.New()
+}
+
+// strip removes whatever the given tier doesn't permit from the update,
+// returning nil if the update shouldn't be reported at all. Unknown tiers are
+// treated like TierNone.
+func strip(tier string, u *update) *update {
+	switch tier {
+	case TierDetailed:
+		return u
+	case TierCountry, TierAnonymous:
+		if u.category == members {
+			// Distinct members are things like hosts and IPs, only report
+			// those for diagnostics
+			return nil
+		}
+		if u.category == gauges {
+			// Statshub tracks gauges per id, and since we post these under
+			// a new id every time, they would look like new instances
+			return nil
+		}
+		dims := make(map[string]string)
+		if country, found := u.dg.dims[countryDim]; found && tier == TierCountry {
+			dims[countryDim] = country
+		}
+		return &update{
+			dg:       &DimGroup{dims},
+			category: u.category,
+			key:      u.key,
+			action:   u.action,
+		}
+	default:
+		return nil
+	}
+}
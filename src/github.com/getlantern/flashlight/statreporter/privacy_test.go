@@ -0,0 +1,51 @@
+package statreporter
+
+import (
+	"testing"
+
+	"github.com/getlantern/testify/assert"
+
+	"github.com/getlantern/flashlight/globals"
+)
+
+func TestStrip(t *testing.T) {
+	dg := Country("ir").And("fallback", "1.2.3.4")
+	incr := &update{dg, increments, "bytesGotten", add(5)}
+	mem := &update{dg, members, "distinctClients", member("5.6.7.8")}
+	gauge := &update{dg, gauges, "fronted", set(1)}
+
+	assert.Equal(t, incr, strip(TierDetailed, incr), "Detailed should report everything")
+	assert.Equal(t, mem, strip(TierDetailed, mem), "Detailed should report members")
+
+	stripped := strip(TierCountry, incr)
+	if assert.NotNil(t, stripped, "Country should report increments") {
+		assert.Equal(t, map[string]string{countryDim: "ir"}, stripped.dg.dims, "Country should only keep country dim")
+		assert.Equal(t, incr.action, stripped.action)
+	}
+	assert.Nil(t, strip(TierCountry, mem), "Country should not report members")
+	assert.Nil(t, strip(TierCountry, gauge), "Country should not report gauges")
+
+	stripped = strip(TierAnonymous, incr)
+	if assert.NotNil(t, stripped, "Anonymous should report increments") {
+		assert.Equal(t, map[string]string{}, stripped.dg.dims, "Anonymous should not keep any dims")
+	}
+	assert.Nil(t, strip(TierAnonymous, mem), "Anonymous should not report members")
+	assert.Nil(t, strip(TierAnonymous, gauge), "Anonymous should not report gauges")
+	assert.Equal(t, gauge, strip(TierDetailed, gauge), "Detailed should report gauges")
+
+	assert.Nil(t, strip(TierNone, incr), "None should report nothing")
+	assert.Nil(t, strip("bogus", incr), "Unknown tiers should report nothing")
+
+	assert.Equal(t, "ir", dg.dims[countryDim], "Stripping shouldn't modify original dims")
+	assert.Equal(t, "1.2.3.4", dg.dims["fallback"], "Stripping shouldn't modify original dims")
+}
+
+func TestReportId(t *testing.T) {
+	globals.InstanceId = "testinstance"
+	assert.Equal(t, "testinstance", reportId(TierDetailed), "Detailed should report under instance id")
+	for _, tier := range []string{TierCountry, TierAnonymous} {
+		id := reportId(tier)
+		assert.NotEqual(t, "testinstance", id, "%s should not report under instance id", tier)
+		assert.NotEqual(t, id, reportId(tier), "%s reports should not be linkable", tier)
+	}
+}
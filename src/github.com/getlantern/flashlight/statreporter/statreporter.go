@@ -33,6 +33,10 @@ type Config struct {
 
 	// StatshubAddr: the address of the statshub server to which to report
 	StatshubAddr string
+
+	// Tier: the privacy tier that determines how much detail we report, one
+	// of TierNone, TierAnonymous, TierCountry or TierDetailed
+	Tier string
 }
 
 type reporter struct {
@@ -84,11 +88,21 @@ func doConfigure(cfg *Config, poster reportPoster) error {
 		return nil
 	}
 
-	if globals.InstanceId == "" {
-		return fmt.Errorf("Must specify InstanceId if reporting stats")
+	if !IsValidTier(cfg.Tier) {
+		log.Errorf("Unknown privacy tier '%s', not reporting stats", cfg.Tier)
+		return nil
+	}
+
+	if cfg.Tier == TierNone {
+		log.Debug("User opted out of stat reporting")
+		return nil
+	}
+
+	if cfg.Tier == TierDetailed && globals.InstanceId == "" {
+		return fmt.Errorf("Must specify InstanceId if reporting detailed stats")
 	}
 
-	log.Debugf("Reporting stats to %s every %s under instance id '%s'", cfg.StatshubAddr, cfg.ReportingPeriod, globals.InstanceId)
+	log.Debugf("Reporting %s stats to %s every %s", cfg.Tier, cfg.StatshubAddr, cfg.ReportingPeriod)
 	currentReporter = &reporter{
 		cfg:    cfg,
 		poster: poster,
@@ -109,6 +123,11 @@ func postUpdate(update *update) {
 	defer cfgMutex.RUnlock()
 
 	if currentReporter != nil {
+		update = strip(currentReporter.cfg.Tier, update)
+		if update == nil {
+			log.Trace("Update not permitted by privacy tier, dropping")
+			return
+		}
 		select {
 		case currentReporter.updatesCh <- update:
 			log.Tracef("Posted update: %s", update)
@@ -236,7 +255,7 @@ func posterForDimGroupStats(cfg *Config) reportPoster {
 			return fmt.Errorf("Unable to marshal json for stats: %s", err)
 		}
 
-		url := fmt.Sprintf(statshubUrlTemplate, cfg.StatshubAddr, globals.InstanceId)
+		url := fmt.Sprintf(statshubUrlTemplate, cfg.StatshubAddr, reportId(cfg.Tier))
 		resp, err := http.Post(url, "application/json", bytes.NewReader(jsonBytes))
 		if err != nil {
 			return fmt.Errorf("Unable to post stats to statshub: %s", err)
@@ -23,6 +23,7 @@ func TestAll(t *testing.T) {
 	// Start reporting
 	err := doConfigure(&Config{
 		ReportingPeriod: 100 * time.Millisecond,
+		Tier:            TierDetailed,
 	}, func(r report) error {
 		go func() {
 			reportCh <- r
@@ -49,6 +50,7 @@ func TestAll(t *testing.T) {
 	// Reconfigure reporting
 	err = doConfigure(&Config{
 		ReportingPeriod: 200 * time.Millisecond,
+		Tier:            TierDetailed,
 	}, func(r report) error {
 		go func() {
 			reportCh <- r
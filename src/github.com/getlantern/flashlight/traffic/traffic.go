@@ -0,0 +1,295 @@
+// Package traffic samples the traffic that Lantern proxies and streams
+// aggregated metrics to the UI for its dashboard. Metrics are sampled and
+// aggregated here so that the UI gets at most one update per sample interval,
+// and fewer if it can't keep up, no matter how busy Lantern is.
+package traffic
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/bytecounting"
+	"github.com/getlantern/golog"
+
+	"github.com/getlantern/flashlight/ui"
+)
+
+const (
+	messageType = "Traffic"
+
+	// historySize is how many samples we keep around for new UI clients and
+	// for determining the top domains.
+	historySize = 60
+
+	// maxTopDomains is how many of the busiest domains we report.
+	maxTopDomains = 10
+
+	// maxDomainsPerSample caps how many distinct domains a single sample
+	// tracks, so that something hitting lots of domains can't use up lots of
+	// memory.
+	maxDomainsPerSample = 1000
+)
+
+var (
+	log = golog.LoggerFor("flashlight.traffic")
+
+	sampleInterval = 1 * time.Second
+
+	service   *ui.Service
+	startOnce sync.Once
+
+	activeTunnels int64
+
+	// Tunnels count their own traffic, we only lock these when tunnels come
+	// and go and when taking a sample. Closed tunnels are kept until the next
+	// sample so that we don't lose their last bytes.
+	tunnelsMutex  sync.Mutex
+	liveTunnels   = make(map[*tunnel]bool)
+	closedTunnels []*tunnel
+
+	mutex         sync.Mutex
+	history       []*sample
+	unpublished   []*Sample
+	lastPublished = &Sample{}
+)
+
+// Update is what we send to the UI.
+type Update struct {
+	// Samples are the samples taken since the last update, oldest first
+	Samples []*Sample `json:"samples"`
+
+	// ActiveTunnels is the number of currently open tunnels
+	ActiveTunnels int64 `json:"activeTunnels"`
+
+	// TopDomains are the domains with the most traffic over the last
+	// historySize samples, busiest first
+	TopDomains []*DomainTraffic `json:"topDomains"`
+}
+
+// Sample is the traffic over one sample interval.
+type Sample struct {
+	Time    time.Time `json:"time"`
+	BPSUp   int64     `json:"bpsUp"`
+	BPSDn   int64     `json:"bpsDn"`
+	Tunnels int64     `json:"tunnels"`
+}
+
+// DomainTraffic is the total traffic for a domain.
+type DomainTraffic struct {
+	Domain string `json:"domain"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type sample struct {
+	*Sample
+	domains map[string]int64
+}
+
+// Start starts sampling traffic and publishing it to the UI.
+func Start() {
+	startOnce.Do(func() {
+		var err error
+		service, err = ui.Register(messageType, nil, func(write func(interface{}) error) error {
+			mutex.Lock()
+			samples := make([]*Sample, 0, len(history))
+			for _, s := range history {
+				samples = append(samples, s.Sample)
+			}
+			update := &Update{
+				Samples:       samples,
+				ActiveTunnels: atomic.LoadInt64(&activeTunnels),
+				TopDomains:    topDomains(),
+			}
+			mutex.Unlock()
+			return write(update)
+		})
+		if err != nil {
+			log.Errorf("Unable to register traffic service: %v", err)
+			return
+		}
+		go run()
+		log.Debug("Started")
+	})
+}
+
+func run() {
+	for now := range time.Tick(sampleInterval) {
+		takeSample(now, sampleInterval)
+		publish()
+	}
+}
+
+// Track counts the traffic over the given connection to the given address
+// and counts it as an active tunnel until it's closed.
+func Track(addr string, conn net.Conn) net.Conn {
+	t := &tunnel{domain: domainOf(addr)}
+	t.Conn = &bytecounting.Conn{
+		Orig: conn,
+		OnRead: func(bytes int64) {
+			atomic.AddInt64(&t.bytesDn, bytes)
+		},
+		OnWrite: func(bytes int64) {
+			atomic.AddInt64(&t.bytesUp, bytes)
+		},
+	}
+	atomic.AddInt64(&activeTunnels, 1)
+	tunnelsMutex.Lock()
+	liveTunnels[t] = true
+	tunnelsMutex.Unlock()
+	return t
+}
+
+// tunnel is a net.Conn that counts its traffic since the last sample and
+// stops counting as active once it's closed.
+type tunnel struct {
+	net.Conn
+	domain    string
+	bytesUp   int64
+	bytesDn   int64
+	closeOnce sync.Once
+}
+
+func (t *tunnel) Close() error {
+	t.closeOnce.Do(func() {
+		atomic.AddInt64(&activeTunnels, -1)
+		tunnelsMutex.Lock()
+		delete(liveTunnels, t)
+		closedTunnels = append(closedTunnels, t)
+		tunnelsMutex.Unlock()
+	})
+	return t.Conn.Close()
+}
+
+// takeSample records the traffic since the last sample, which was taken
+// interval ago.
+func takeSample(now time.Time, interval time.Duration) {
+	tunnelsMutex.Lock()
+	tunnels := closedTunnels
+	closedTunnels = nil
+	for t := range liveTunnels {
+		tunnels = append(tunnels, t)
+	}
+	tunnelsMutex.Unlock()
+
+	var bytesUp, bytesDn int64
+	domains := make(map[string]int64)
+	for _, t := range tunnels {
+		up := atomic.SwapInt64(&t.bytesUp, 0)
+		dn := atomic.SwapInt64(&t.bytesDn, 0)
+		bytesUp += up
+		bytesDn += dn
+		if up+dn == 0 {
+			continue
+		}
+		if _, found := domains[t.domain]; found || len(domains) < maxDomainsPerSample {
+			domains[t.domain] += up + dn
+		}
+	}
+
+	seconds := interval.Seconds()
+	s := &sample{
+		Sample: &Sample{
+			Time:    now,
+			BPSUp:   int64(float64(bytesUp) / seconds),
+			BPSDn:   int64(float64(bytesDn) / seconds),
+			Tunnels: atomic.LoadInt64(&activeTunnels),
+		},
+		domains: domains,
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	history = append(history, s)
+	if len(history) > historySize {
+		history = history[len(history)-historySize:]
+	}
+	unpublished = append(unpublished, s.Sample)
+	if len(unpublished) > historySize {
+		unpublished = unpublished[len(unpublished)-historySize:]
+	}
+}
+
+// publish sends the unpublished samples to the UI, unless the UI hasn't picked
+// up our last update yet, in which case we hold on to them and send them along
+// with the next update instead of queueing up more updates. We also don't
+// bother the UI while there's no traffic.
+func publish() {
+	if len(service.Out) > 0 {
+		log.Trace("UI hasn't picked up last update, holding on to samples")
+		return
+	}
+	mutex.Lock()
+	if isIdle() {
+		unpublished = nil
+		mutex.Unlock()
+		return
+	}
+	update := &Update{
+		Samples:       unpublished,
+		ActiveTunnels: atomic.LoadInt64(&activeTunnels),
+		TopDomains:    topDomains(),
+	}
+	lastPublished = unpublished[len(unpublished)-1]
+	unpublished = nil
+	mutex.Unlock()
+	// Only publish sends to service.Out, so there's still room
+	service.Out <- update
+}
+
+// isIdle checks whether nothing happened since the last update, which already
+// told the UI that there's no traffic.
+func isIdle() bool {
+	if lastPublished.BPSUp != 0 || lastPublished.BPSDn != 0 {
+		return false
+	}
+	for _, s := range unpublished {
+		if s.BPSUp != 0 || s.BPSDn != 0 || s.Tunnels != lastPublished.Tunnels {
+			return false
+		}
+	}
+	return true
+}
+
+// topDomains totals the traffic per domain over the history and returns the
+// busiest ones.
+func topDomains() []*DomainTraffic {
+	totals := make(map[string]int64)
+	for _, s := range history {
+		for domain, bytes := range s.domains {
+			totals[domain] += bytes
+		}
+	}
+	result := make([]*DomainTraffic, 0, len(totals))
+	for domain, bytes := range totals {
+		result = append(result, &DomainTraffic{domain, bytes})
+	}
+	sort.Sort(byBytesDescending(result))
+	if len(result) > maxTopDomains {
+		result = result[:maxTopDomains]
+	}
+	return result
+}
+
+// domainOf extracts the domain from a host:port address.
+func domainOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return strings.ToLower(host)
+}
+
+type byBytesDescending []*DomainTraffic
+
+func (a byBytesDescending) Len() int      { return len(a) }
+func (a byBytesDescending) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byBytesDescending) Less(i, j int) bool {
+	if a[i].Bytes == a[j].Bytes {
+		return a[i].Domain < a[j].Domain
+	}
+	return a[i].Bytes > a[j].Bytes
+}
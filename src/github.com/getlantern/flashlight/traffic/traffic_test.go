@@ -0,0 +1,84 @@
+package traffic
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getlantern/testify/assert"
+)
+
+func TestSampling(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		b := make([]byte, 100)
+		for {
+			n, err := server.Read(b)
+			if err != nil {
+				return
+			}
+			if _, err := server.Write(b[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn := Track("www.Example.com:443", client)
+	other := Track("other.com:443", nopConn{})
+	assert.Equal(t, int64(2), activeTunnels)
+
+	b := make([]byte, 10)
+	for i := 0; i < 10; i++ {
+		if _, err := conn.Write(b); !assert.NoError(t, err) {
+			return
+		}
+		if _, err := conn.Read(b); !assert.NoError(t, err) {
+			return
+		}
+	}
+	atomic.AddInt64(&other.(*tunnel).bytesDn, 50)
+
+	takeSample(time.Now(), 2*time.Second)
+	if assert.Len(t, unpublished, 1) {
+		s := unpublished[0]
+		assert.Equal(t, int64(50), s.BPSUp, "Should have averaged bytes up over interval")
+		assert.Equal(t, int64(75), s.BPSDn, "Should have averaged bytes down over interval")
+		assert.Equal(t, int64(2), s.Tunnels)
+	}
+	assert.Equal(t, []*DomainTraffic{
+		{"www.example.com", 200},
+		{"other.com", 50},
+	}, topDomains())
+
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, other.Close())
+	assert.Equal(t, int64(0), activeTunnels, "Closing twice should only count once")
+
+	takeSample(time.Now(), time.Second)
+	assert.Len(t, history, 2)
+	assert.False(t, isIdle(), "Closed tunnels should be reported")
+
+	// Publish the busy sample
+	lastPublished = unpublished[0]
+	unpublished = unpublished[1:]
+	assert.False(t, isIdle(), "First quiet sample after busy one should be reported")
+
+	// Publish the quiet sample
+	lastPublished = unpublished[0]
+	unpublished = nil
+	takeSample(time.Now(), time.Second)
+	assert.True(t, isIdle(), "Nothing happened since last quiet sample")
+	assert.Empty(t, liveTunnels)
+	assert.Empty(t, closedTunnels)
+}
+
+type nopConn struct {
+	net.Conn
+}
+
+func (c nopConn) Close() error {
+	return nil
+}
@@ -109,6 +109,11 @@ type Config struct {
 	// the server to report stats on what was dialed and how long each step
 	// took.
 	OnDialStats func(success bool, domain, addr string, resolutionTime, connectTime, handshakeTime time.Duration)
+
+	// FailMasquerade: optional, for testing. If it returns true for a
+	// masquerade, dialing via that masquerade fails without touching the
+	// network, which allows exercising masquerade failover on demand.
+	FailMasquerade func(masquerade *Masquerade) bool
 }
 
 // dialer implements the proxy.Dialer interface by dialing domain-fronted
@@ -250,14 +255,21 @@ func (d *dialer) enproxyConfigWith(dialProxy func(addr string) (net.Conn, error)
 }
 
 func (d *dialer) dialServer() (net.Conn, error) {
-	var masquerade *Masquerade
-	if d.masquerades != nil {
-		masquerade = d.masquerades.nextVerified()
+	if d.masquerades == nil {
+		return d.dialServerWith(nil)
 	}
-	return d.dialServerWith(masquerade)
+	masquerade := d.masquerades.nextVerified()
+	start := time.Now()
+	conn, err := d.dialServerWith(masquerade)
+	d.masquerades.recordResult(masquerade, err == nil, time.Now().Sub(start))
+	return conn, err
 }
 
 func (d *dialer) dialServerWith(masquerade *Masquerade) (net.Conn, error) {
+	if masquerade != nil && d.FailMasquerade != nil && d.FailMasquerade(masquerade) {
+		return nil, fmt.Errorf("Unable to dial masquerade %s: failure injected", masquerade.Domain)
+	}
+
 	dialTimeout := time.Duration(d.DialTimeoutMillis) * time.Millisecond
 	if dialTimeout == 0 {
 		dialTimeout = 30 * time.Second
@@ -12,6 +12,19 @@ import (
 
 const (
 	NumWorkers = 10 // number of worker goroutines for verifying
+
+	// baseCooldown is how long a masquerade sits out after its first failure.
+	// Each consecutive failure doubles this, up to maxCooldown.
+	baseCooldown         = 10 * time.Second
+	maxCooldown          = 5 * time.Minute
+	maxCooldownDoublings = 8
+
+	// rttSmoothing controls how quickly our RTT average follows new samples.
+	rttSmoothing = 4
+
+	// minRTT floors RTTs when weighting so that one lucky sample doesn't
+	// give a masquerade all of the traffic.
+	minRTT = 10 * time.Millisecond
 )
 
 // Masquerade contains the data for a single masquerade host, including
@@ -29,45 +42,149 @@ type MasqueradeSet []*Masquerade
 
 // verifiedMasqueradeSet represents a set of Masquerade configurations.
 // verifiedMasqueradeSet verifies each configured Masquerade by attempting to
-// proxy using it.
+// proxy using it. Verified masquerades are then selected at random, weighted
+// by how reliable and how fast they've been, and masquerades that fail are
+// put in a cooldown during which they're not selected.
 type verifiedMasqueradeSet struct {
 	dialer             *dialer
 	candidatesCh       chan *Masquerade
 	stopCh             chan interface{}
-	verifiedChSize     int
-	verifiedCh         chan *Masquerade
+	maxVerified        int
+	verified           []*masqueradeStats
+	statsByMasquerade  map[*Masquerade]*masqueradeStats
+	verifiedMutex      sync.Mutex
+	firstVerifiedCh    chan interface{}
 	verifiedCount      int
 	verifiedCountMutex sync.Mutex
 	wg                 sync.WaitGroup
 }
 
-// nextVerified returns the next available verified *Masquerade, blocking until
-// such is available.  The masquerade is immediately written back onto
-// verifiedCh, turning verifiedCh into a sort of cyclic queue.
+// masqueradeStats tracks how well a verified Masquerade has been working.
+type masqueradeStats struct {
+	masquerade       *Masquerade
+	successes        int
+	failures         int
+	consecFailures   int
+	rtt              time.Duration // exponentially weighted moving average
+	coolingDownUntil time.Time
+}
+
+// nextVerified returns a verified *Masquerade, blocking until at least one is
+// available. Masquerades that aren't cooling down are chosen at random,
+// weighted towards the healthy ones. If all masquerades are cooling down, the
+// one whose cooldown ends soonest is used.
 func (vms *verifiedMasqueradeSet) nextVerified() *Masquerade {
-	masquerade := <-vms.verifiedCh
-	vms.verifiedCh <- masquerade
-	return masquerade
+	<-vms.firstVerifiedCh
+
+	vms.verifiedMutex.Lock()
+	defer vms.verifiedMutex.Unlock()
+
+	now := time.Now()
+	var available []*masqueradeStats
+	totalWeight := float64(0)
+	soonest := vms.verified[0]
+	for _, ms := range vms.verified {
+		if ms.coolingDownUntil.Before(now) {
+			available = append(available, ms)
+			totalWeight += ms.weight()
+		} else if ms.coolingDownUntil.Before(soonest.coolingDownUntil) {
+			soonest = ms
+		}
+	}
+	if len(available) == 0 {
+		log.Debugf("All masquerades cooling down, using %s", soonest.masquerade.Domain)
+		return soonest.masquerade
+	}
+
+	t := rand.Float64() * totalWeight
+	for _, ms := range available {
+		t -= ms.weight()
+		if t < 0 {
+			return ms.masquerade
+		}
+	}
+	// Can only get here through rounding
+	return available[len(available)-1].masquerade
+}
+
+// recordResult records the outcome of dialing with the given masquerade,
+// putting failing masquerades into an exponentially growing cooldown.
+func (vms *verifiedMasqueradeSet) recordResult(masquerade *Masquerade, success bool, rtt time.Duration) {
+	vms.verifiedMutex.Lock()
+	defer vms.verifiedMutex.Unlock()
+
+	ms := vms.statsByMasquerade[masquerade]
+	if ms == nil {
+		log.Tracef("Ignoring result for unverified masquerade %s", masquerade.Domain)
+		return
+	}
+	if success {
+		ms.successes += 1
+		ms.consecFailures = 0
+		ms.coolingDownUntil = time.Time{}
+		if ms.rtt == 0 {
+			ms.rtt = rtt
+		} else {
+			ms.rtt = (ms.rtt*(rttSmoothing-1) + rtt) / rttSmoothing
+		}
+		return
+	}
+
+	ms.failures += 1
+	ms.consecFailures += 1
+	cooldown := maxCooldown
+	if ms.consecFailures <= maxCooldownDoublings {
+		cooldown = baseCooldown * time.Duration(1<<uint(ms.consecFailures-1))
+		if cooldown > maxCooldown {
+			cooldown = maxCooldown
+		}
+	}
+	ms.coolingDownUntil = time.Now().Add(cooldown)
+	log.Debugf("Masquerade %s failed %d times in a row, cooling down for %s", masquerade.Domain, ms.consecFailures, cooldown)
+}
+
+// addVerified adds a masquerade that passed verification, with the round trip
+// time observed during verification.
+func (vms *verifiedMasqueradeSet) addVerified(masquerade *Masquerade, rtt time.Duration) {
+	vms.verifiedMutex.Lock()
+	defer vms.verifiedMutex.Unlock()
+
+	ms := &masqueradeStats{
+		masquerade: masquerade,
+		successes:  1,
+		rtt:        rtt,
+	}
+	vms.verified = append(vms.verified, ms)
+	vms.statsByMasquerade[masquerade] = ms
+	if len(vms.verified) == 1 {
+		close(vms.firstVerifiedCh)
+	}
+}
+
+// weight determines how likely this masquerade is to be selected, favoring
+// masquerades that usually succeed and that respond quickly.
+func (ms *masqueradeStats) weight() float64 {
+	// Smoothed success rate, so that a single result doesn't dominate
+	successRate := float64(ms.successes+1) / float64(ms.successes+ms.failures+2)
+	rtt := ms.rtt
+	if rtt < minRTT {
+		rtt = minRTT
+	}
+	return successRate / rtt.Seconds()
 }
 
 // verified sets up a new verifiedMasqueradeSet that verifies each of the
 // Masquerades in this MasqueradeSet for the given Dialer.
 func (d *dialer) verifiedMasquerades() *verifiedMasqueradeSet {
-	// Size verifiedChSize to be able to hold the smaller of MaxMasquerades or
-	// the number of configured masquerades.
-	verifiedChSize := len(d.Masquerades)
-	if d.MaxMasquerades < verifiedChSize {
-		verifiedChSize = d.MaxMasquerades
+	// Verify the smaller of MaxMasquerades or the number of configured
+	// masquerades.
+	maxVerified := len(d.Masquerades)
+	if d.MaxMasquerades < maxVerified {
+		maxVerified = d.MaxMasquerades
 	}
-	log.Debugf("Verifying up to %d masquerades", verifiedChSize)
+	log.Debugf("Verifying up to %d masquerades", maxVerified)
 
-	vms := &verifiedMasqueradeSet{
-		dialer:         d,
-		candidatesCh:   make(chan *Masquerade),
-		stopCh:         make(chan interface{}, 1),
-		verifiedChSize: verifiedChSize,
-		verifiedCh:     make(chan *Masquerade, verifiedChSize),
-	}
+	vms := newVerifiedMasqueradeSet(d, maxVerified)
 	vms.wg.Add(NumWorkers)
 	// Spawn some worker goroutines to verify masquerades
 	for i := 0; i < NumWorkers; i++ {
@@ -80,6 +197,18 @@ func (d *dialer) verifiedMasquerades() *verifiedMasqueradeSet {
 	return vms
 }
 
+func newVerifiedMasqueradeSet(d *dialer, maxVerified int) *verifiedMasqueradeSet {
+	return &verifiedMasqueradeSet{
+		dialer:            d,
+		candidatesCh:      make(chan *Masquerade),
+		stopCh:            make(chan interface{}, 1),
+		maxVerified:       maxVerified,
+		verified:          make([]*masqueradeStats, 0, maxVerified),
+		statsByMasquerade: make(map[*Masquerade]*masqueradeStats, maxVerified),
+		firstVerifiedCh:   make(chan interface{}),
+	}
+}
+
 // feedCandidates feeds the candidate masquerades to our worker routines in
 // random order
 func (vms *verifiedMasqueradeSet) feedCandidates() {
@@ -130,6 +259,7 @@ func (vms *verifiedMasqueradeSet) verify() {
 // not to continue processing more verifications.
 func (vms *verifiedMasqueradeSet) doVerify(masquerade *Masquerade) bool {
 	errCh := make(chan error, 2)
+	var rtt time.Duration
 	go func() {
 		// Limit amount of time we'll wait for a response
 		time.Sleep(30 * time.Second)
@@ -157,8 +287,8 @@ func (vms *verifiedMasqueradeSet) doVerify(masquerade *Masquerade) bool {
 			if err != nil {
 				errCh <- fmt.Errorf("HTTP Body Error: %s", body)
 			} else {
-				delta := time.Now().Sub(start)
-				log.Debugf("Sucessful check for: %s in %s, %s", masquerade.Domain, delta, body)
+				rtt = time.Now().Sub(start)
+				log.Debugf("Sucessful check for: %s in %s, %s", masquerade.Domain, rtt, body)
 				errCh <- nil
 			}
 		}
@@ -169,7 +299,7 @@ func (vms *verifiedMasqueradeSet) doVerify(masquerade *Masquerade) bool {
 		return true
 	}
 	if vms.incrementVerifiedCount() {
-		vms.verifiedCh <- masquerade
+		vms.addVerified(masquerade, rtt)
 		return true
 	}
 	return false
@@ -180,7 +310,7 @@ func (vms *verifiedMasqueradeSet) doVerify(masquerade *Masquerade) bool {
 func (vms *verifiedMasqueradeSet) incrementVerifiedCount() bool {
 	vms.verifiedCountMutex.Lock()
 	defer vms.verifiedCountMutex.Unlock()
-	if vms.verifiedCount == vms.verifiedChSize {
+	if vms.verifiedCount == vms.maxVerified {
 		return false
 	}
 	vms.verifiedCount += 1
@@ -0,0 +1,53 @@
+package fronted
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/testify/assert"
+)
+
+func TestMasqueradeSelection(t *testing.T) {
+	healthy := &Masquerade{Domain: "healthy.com"}
+	slow := &Masquerade{Domain: "slow.com"}
+	failing := &Masquerade{Domain: "failing.com"}
+
+	vms := newVerifiedMasqueradeSet(nil, 3)
+	vms.addVerified(healthy, 50*time.Millisecond)
+	vms.addVerified(slow, 2*time.Second)
+	vms.addVerified(failing, 50*time.Millisecond)
+
+	vms.recordResult(failing, false, 0)
+	ms := vms.statsByMasquerade[failing]
+	assert.Equal(t, 1, ms.consecFailures, "Failure should have been recorded")
+	assert.True(t, ms.coolingDownUntil.After(time.Now()), "Failing masquerade should be cooling down")
+
+	counts := make(map[*Masquerade]int)
+	for i := 0; i < 1000; i++ {
+		counts[vms.nextVerified()]++
+	}
+	assert.Equal(t, 0, counts[failing], "Masquerade cooling down should never be selected")
+	assert.True(t, counts[healthy] > counts[slow]*5, "Fast masquerade should be strongly preferred, got %d vs %d", counts[healthy], counts[slow])
+
+	vms.recordResult(failing, false, 0)
+	assert.True(t, ms.coolingDownUntil.After(time.Now().Add(baseCooldown)), "Cooldown should grow with consecutive failures")
+
+	vms.recordResult(failing, true, 50*time.Millisecond)
+	assert.Equal(t, 0, ms.consecFailures, "Success should reset consecutive failures")
+	assert.True(t, ms.coolingDownUntil.IsZero(), "Success should end cooldown")
+}
+
+func TestAllMasqueradesCoolingDown(t *testing.T) {
+	first := &Masquerade{Domain: "first.com"}
+	second := &Masquerade{Domain: "second.com"}
+
+	vms := newVerifiedMasqueradeSet(nil, 2)
+	vms.addVerified(first, 50*time.Millisecond)
+	vms.addVerified(second, 50*time.Millisecond)
+
+	vms.recordResult(first, false, 0)
+	vms.recordResult(first, false, 0)
+	vms.recordResult(second, false, 0)
+
+	assert.Equal(t, second, vms.nextVerified(), "Should use masquerade whose cooldown ends soonest")
+}
@@ -3,7 +3,9 @@ package launcher
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"text/template"
 
 	"github.com/getlantern/appdir"
@@ -67,3 +69,13 @@ func CreateLaunchFile(autoLaunch bool) {
 		log.Errorf("Error writing to launchd plist file: %q", err)
 	}
 }
+
+// RemoveLaunchFile removes the launchd plist file, for when Lantern is being
+// uninstalled.
+func RemoveLaunchFile() error {
+	fname := appdir.InHomeDir(LaunchdPlistFile)
+	if err := os.Remove(fname); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error removing launchd plist file: %q", err)
+	}
+	return nil
+}
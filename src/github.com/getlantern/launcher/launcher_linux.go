@@ -4,3 +4,7 @@ package launcher
 func CreateLaunchFile(autoLaunch bool) {
 
 }
+
+func RemoveLaunchFile() error {
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/kardianos/osext"
 	"github.com/luisiturrios/gowin"
+	"golang.org/x/sys/windows/registry"
 
 	"github.com/getlantern/golog"
 )
@@ -39,3 +40,17 @@ func CreateLaunchFile(autoLaunch bool) {
 		log.Errorf("Error setting Lantern auto-start registry key: %q", err)
 	}
 }
+
+// RemoveLaunchFile removes the Lantern auto-start registry value, for when
+// Lantern is being uninstalled.
+func RemoveLaunchFile() error {
+	k, err := registry.OpenKey(registry.CURRENT_USER, runDir, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("Error opening auto-start registry key: %q", err)
+	}
+	defer k.Close()
+	if err := k.DeleteValue("Lantern"); err != nil && err != registry.ErrNotExist {
+		return fmt.Errorf("Error removing Lantern auto-start registry value: %q", err)
+	}
+	return nil
+}
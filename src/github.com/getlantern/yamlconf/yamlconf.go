@@ -49,6 +49,14 @@ type Config interface {
 // update, the Version in the file will not match the Version in memory, and the
 // file will be rejected and overwritten with the latest Version from memory.
 //
+// Since the file on disk is rewritten from memory, any comments and formatting
+// in it are lost. Settings that are maintained by hand should instead go into
+// the optional overrides file, which Manager only ever reads. Whenever the
+// config changes, and whenever the overrides file itself changes, the settings
+// in the overrides file are applied on top of the config, so they always win
+// over programmatic updates. Removing a setting from the overrides file leaves
+// its last value in place until something else changes it.
+//
 // Programmatic updates (including ones via the HTTP config server and custom
 // polling) are processed serialy. Since these operations are all defined as
 // mutators that receive the current version of the config, the order of
@@ -94,6 +102,11 @@ type Manager struct {
 	// to 1 second
 	FilePollInterval time.Duration
 
+	// OverridesFilePath: optional, path to a YAML file of hand-maintained
+	// settings that are applied on top of the config and that is never
+	// written to
+	OverridesFilePath string
+
 	// EmptyConfig: required, factor for new empty Configs
 	EmptyConfig func() Config
 
@@ -108,12 +121,14 @@ type Manager struct {
 	// example for fetching config updates from a remote server.
 	CustomPoll func(currentCfg Config) (mutate func(cfg Config) error, waitTime time.Duration, err error)
 
-	once      sync.Once
-	cfg       Config
-	cfgMutex  sync.RWMutex
-	fileInfo  os.FileInfo
-	deltasCh  chan *delta
-	nextCfgCh chan Config
+	once           sync.Once
+	cfg            Config
+	cfgMutex       sync.RWMutex
+	fileInfo       os.FileInfo
+	overrides      []byte
+	validOverrides []byte
+	deltasCh       chan *delta
+	nextCfgCh      chan Config
 }
 
 type mutator func(cfg Config) error
@@ -152,6 +167,7 @@ func (m *Manager) Init() (Config, error) {
 	}
 	m.deltasCh = make(chan *delta)
 	m.nextCfgCh = make(chan Config)
+	m.readOverrides()
 
 	err := m.loadFromDisk()
 	if err != nil {
@@ -224,6 +240,19 @@ func (m *Manager) processUpdates() {
 				log.Errorf("Unable to read updated config from disk: %s", err)
 				continue
 			}
+			if m.overridesChanged() {
+				log.Debug("Overrides changed on disk, applying")
+				m.readOverrides()
+				updated, err := m.copy(m.getCfg())
+				if err == nil {
+					var overridden bool
+					overridden, err = m.saveToDiskAndUpdate(updated)
+					changed = changed || overridden
+				}
+				if err != nil {
+					log.Errorf("Unable to apply updated overrides: %s", err)
+				}
+			}
 		}
 
 		if changed {
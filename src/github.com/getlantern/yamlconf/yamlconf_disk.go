@@ -33,6 +33,7 @@ func (m *Manager) reloadFromDisk() (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("Error unmarshaling config yaml from %s: %s", m.FilePath, err)
 	}
+	m.applyOverrides(cfg)
 
 	if m.cfg != nil && m.cfg.GetVersion() != cfg.GetVersion() {
 		log.Trace("Version mismatch on disk, overwriting what's on disk with current version")
@@ -58,6 +59,8 @@ func (m *Manager) reloadFromDisk() (bool, error) {
 func (m *Manager) saveToDiskAndUpdate(updated Config) (bool, error) {
 	log.Trace("Applying defaults before saving")
 	updated.ApplyDefaults()
+	log.Trace("Applying overrides before saving")
+	m.applyOverrides(updated)
 
 	log.Trace("Remembering current version")
 	original := m.cfg
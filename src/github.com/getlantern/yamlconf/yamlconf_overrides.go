@@ -0,0 +1,73 @@
+package yamlconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/getlantern/yaml"
+)
+
+// applyOverrides applies the last valid overrides we read on top of the given
+// config. Only the settings that appear in the overrides file are changed,
+// maps are merged and everything else is replaced.
+func (m *Manager) applyOverrides(cfg Config) {
+	if m.validOverrides == nil {
+		return
+	}
+	version := cfg.GetVersion()
+	if err := yaml.Unmarshal(m.validOverrides, cfg); err != nil {
+		// Shouldn't happen since we already parsed them in readOverrides
+		log.Errorf("Unable to apply overrides from %s: %s", m.OverridesFilePath, err)
+	}
+	// Overrides don't get a say in the version
+	cfg.SetVersion(version)
+}
+
+// readOverrides reads the overrides file, remembering the last version of it
+// that parsed so that a mistake while hand editing it doesn't take away all
+// overrides.
+func (m *Manager) readOverrides() {
+	if m.OverridesFilePath == "" {
+		return
+	}
+	b, err := m.readOverridesFile()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	m.overrides = b
+	if err := yaml.Unmarshal(b, m.EmptyConfig()); err != nil {
+		log.Errorf("Error unmarshaling overrides yaml from %s, ignoring changes: %s", m.OverridesFilePath, err)
+		return
+	}
+	m.validOverrides = b
+}
+
+// overridesChanged checks whether the overrides file changed since we last
+// read it.
+func (m *Manager) overridesChanged() bool {
+	if m.OverridesFilePath == "" {
+		return false
+	}
+	b, err := m.readOverridesFile()
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	return !bytes.Equal(b, m.overrides)
+}
+
+// readOverridesFile reads the overrides file, treating a missing file as empty
+// since it's entirely optional.
+func (m *Manager) readOverridesFile() ([]byte, error) {
+	b, err := ioutil.ReadFile(m.OverridesFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []byte{}, nil
+		}
+		return nil, fmt.Errorf("Error reading overrides from %s: %s", m.OverridesFilePath, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,95 @@
+package yamlconf
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/getlantern/testify/assert"
+)
+
+func TestOverrides(t *testing.T) {
+	file, err := ioutil.TempFile("", "yamlconf_test_")
+	if err != nil {
+		t.Fatalf("Unable to create temp file: %s", err)
+	}
+	defer os.Remove(file.Name())
+	overridesFile, err := ioutil.TempFile("", "yamlconf_overrides_test_")
+	if err != nil {
+		t.Fatalf("Unable to create temp file: %s", err)
+	}
+	defer os.Remove(overridesFile.Name())
+
+	overrides := []byte("# Maintained by hand\nn:\n  s: mine # keep this\n")
+	if err := ioutil.WriteFile(overridesFile.Name(), overrides, 0644); err != nil {
+		t.Fatalf("Unable to write overrides: %s", err)
+	}
+
+	m := &Manager{
+		EmptyConfig: func() Config {
+			return &TestCfg{}
+		},
+		FilePath:          file.Name(),
+		FilePollInterval:  pollInterval,
+		OverridesFilePath: overridesFile.Name(),
+	}
+
+	first, err := m.Init()
+	if err != nil {
+		t.Fatalf("Unable to Init manager: %s", err)
+	}
+	assert.Equal(t, &TestCfg{
+		Version: 1,
+		N: &Nested{
+			S: "mine",
+			I: FIXED_I,
+		},
+	}, first, "First config should include overrides")
+
+	go func() {
+		err := m.Update(func(cfg Config) error {
+			tc := cfg.(*TestCfg)
+			tc.N.S = "theirs"
+			tc.N.I = 4
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Unable to issue update: %s", err)
+		}
+	}()
+
+	updated := m.Next()
+	assert.Equal(t, &TestCfg{
+		Version: 2,
+		N: &Nested{
+			S: "mine",
+			I: 4,
+		},
+	}, updated, "Overrides should win over programmatic updates")
+
+	go func() {
+		// Garbage in the overrides file should be ignored
+		if err := ioutil.WriteFile(overridesFile.Name(), []byte("n: [unclosed"), 0644); err != nil {
+			t.Errorf("Unable to write overrides: %s", err)
+		}
+		time.Sleep(pollInterval * 2)
+		if err := ioutil.WriteFile(overridesFile.Name(), []byte("n:\n  i: 7\n"), 0644); err != nil {
+			t.Errorf("Unable to write overrides: %s", err)
+		}
+	}()
+
+	updated = m.Next()
+	assert.Equal(t, &TestCfg{
+		Version: 3,
+		N: &Nested{
+			S: "mine",
+			I: 7,
+		},
+	}, updated, "Changes to overrides should be applied")
+
+	b, err := ioutil.ReadFile(overridesFile.Name())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "n:\n  i: 7\n", string(b), "Overrides file should never be rewritten")
+	}
+}